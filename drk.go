@@ -1,24 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/codingconcepts/drk/pkg/model"
 	"github.com/codingconcepts/drk/pkg/monitoring"
 	"github.com/codingconcepts/drk/pkg/repo"
 	"github.com/codingconcepts/env"
-	"github.com/codingconcepts/ring"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/googleapis/go-sql-spanner"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -34,6 +36,15 @@ var (
 	version string
 )
 
+// Exit codes, allowing drk to be used as a gate in CI pipelines.
+const (
+	exitCodeOK                = 0
+	exitCodeError             = 1
+	exitCodeThresholdsFailed  = 99
+	exitCodeThresholdsAborted = 100
+	exitCodeChecksFailed      = 101
+)
+
 func main() {
 	var e model.EnvironmentVariables
 
@@ -43,17 +54,21 @@ func main() {
 	flag.StringVar(&e.Driver, "driver", "pgx", "database driver to use [mysql, spanner, pgx]")
 	flag.DurationVar(&e.Duration, "duration", time.Minute*10, "total duration of simulation")
 	flag.DurationVar(&e.ConnectionLifetime, "connection-lifetime", time.Minute*1, "amount of time a connection can be reused")
-	flag.IntVar(&e.Retries, "retries", 1, "number of request retries")
-	flag.DurationVar(&e.QueryTimeout, "query-timeout", time.Second*5, "timeout for database queries")
+	flag.IntVar(&e.Retries, "retries", 1, "number of attempts per request, for activities without a retry policy")
+	flag.DurationVar(&e.QueryTimeout, "query-timeout", time.Second*5, "timeout for each attempt of a database query")
+	flag.DurationVar(&e.GracePeriod, "grace-period", time.Second*10, "time to wait for in-flight queries to finish after an interrupt")
+	flag.DurationVar(&e.TeardownTimeout, "teardown-timeout", time.Minute, "maximum time to spend running the teardown workflow (0 for no limit)")
 	flag.BoolVar(&e.Debug, "debug", false, "show debugging logs")
 	flag.BoolVar(&e.Errors, "errors", false, "print each  error as it's encountered")
 	flag.BoolVar(&e.Sensitive, "sensitive", false, "show sensitive logs")
 	flag.IntVar(&e.AverageWindowSize, "average-window-size", 1000, "number of request to derive an average latency for")
 	flag.BoolVar(&e.NoColor, "no-color", false, "print logs without color")
+	flag.StringVar(&e.Report, "report", "", "path to write an end-of-run report to [.json, .md, .html]")
 
 	dryRun := flag.Bool("dry-run", false, "if specified, prints config and exits")
 	showVersion := flag.Bool("version", false, "display the application version")
 	mode := flag.String("output", "log", "type of metrics output to print [log, table]")
+	percentilesFlag := flag.String("percentiles", "50,95,99", "comma-separated latency percentiles to print")
 	clear := flag.Bool("clear", false, "clear the terminal before printing metrics")
 	flag.Parse()
 
@@ -92,13 +107,27 @@ func main() {
 		log.Fatalf("invalid output type: %q (should be one of: %v)", *mode, monitoring.ValidPrintModes)
 	}
 
-	cfg, err := loadConfig(e.Config, e.RawConfig)
+	percentiles, err := monitoring.ParsePercentiles(*percentilesFlag)
+	if err != nil {
+		log.Fatalf("invalid percentiles: %v", err)
+	}
+
+	cfg, configHash, err := loadConfig(e.Config, e.RawConfig)
 	if err != nil {
 		log.Fatalf("error loading config: %v", err)
 	}
 
-	vuStarted := make(chan struct{}, 10)
-	printer := monitoring.NewPrinter(monitoring.PrintMode(*mode), *clear, vuStarted, &logger)
+	missingDialects, err := cfg.ApplyDialects(e.Driver)
+	if err != nil {
+		log.Fatalf("error applying dialects: %v", err)
+	}
+
+	for _, name := range missingDialects {
+		logger.Warn().Str("activity", name).Str("driver", e.Driver).Msg("no dialect for driver, using default query")
+	}
+
+	vuCounts := make(chan int, 10)
+	printer := monitoring.NewPrinter(monitoring.PrintMode(*mode), *clear, percentiles, vuCounts, &logger)
 	printer.PrintConfig(cfg)
 
 	if *dryRun {
@@ -117,7 +146,7 @@ func main() {
 	db.SetConnMaxIdleTime(e.ConnectionLifetime)
 	logger.Debug().Msg("db connection established")
 
-	queryer := repo.NewDBRepo(db, e.QueryTimeout, e.Retries)
+	queryer := repo.NewDBRepo(db)
 
 	timeout, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
@@ -126,101 +155,232 @@ func main() {
 	}
 	logger.Debug().Msg("db connection tested")
 
-	runner, err := model.NewRunner(cfg, queryer, e, vuStarted, &logger)
+	runner, err := model.NewRunner(cfg, queryer, e, vuCounts, &logger)
 	if err != nil {
 		log.Fatalf("error creating runner: %v", err)
 	}
 
-	summaryC := make(chan struct{})
-	go monitor(runner, e, printer, summaryC)
+	// Run checks on a dedicated connection, so they're not starved of
+	// connections by the workload.
+	var checkDB *sql.DB
+	if len(cfg.Checks) > 0 {
+		if checkDB, err = sql.Open(e.Driver, e.URL); err != nil {
+			log.Fatalf("connecting to database for checks: %v", err)
+		}
+		checkDB.SetMaxOpenConns(1)
+		checkDB.SetMaxIdleConns(1)
+
+		if err = checkDB.PingContext(timeout); err != nil {
+			log.Fatalf("error connecting to database for checks: %v", err)
+		}
+		logger.Debug().Msg("check db connection tested")
+
+		runner.SetCheckDB(repo.NewDBRepo(checkDB))
+	}
+
+	meta := monitoring.ReportMetadata{
+		Version:    version,
+		Driver:     e.Driver,
+		ConfigHash: configHash,
+		Duration:   e.Duration,
+		Started:    time.Now(),
+	}
+
+	summaryC := make(chan int)
+	go monitor(runner, e, printer, percentiles, cfg.Thresholds, meta, summaryC)
 
 	http.Handle("/metrics", promhttp.Handler())
 	go http.ListenAndServe(":2112", nil)
 
-	if err = runner.Run(); err != nil {
-		log.Fatalf("error running config: %v", err)
+	ctx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+	go shutdown(runner, e.GracePeriod, cancelRun)
+
+	runErr := runner.Run(ctx)
+	if runErr != nil {
+		log.Printf("error running config: %v", runErr)
+	}
+
+	// Checks have finished once the run has (and deferred calls won't
+	// run, given os.Exit), so close their connection now.
+	if checkDB != nil {
+		checkDB.Close()
 	}
 
 	// Tell the monitor function to print a summary, then wait
-	// for it to finish using the same channel.
-	summaryC <- struct{}{}
-	<-summaryC
+	// for it to finish (and return an exit code) using the same channel.
+	summaryC <- exitCodeOK
+	exitCode := <-summaryC
+
+	if exitCode == exitCodeOK && runErr != nil && ctx.Err() == nil {
+		exitCode = exitCodeError
+	}
+	os.Exit(exitCode)
 }
 
-func monitor(r *model.Runner, e model.EnvironmentVariables, printer *monitoring.Printer, summary chan struct{}) {
+// shutdown stops the runner on SIGINT or SIGTERM, allowing in-flight
+// queries to finish, before cancelling them once the grace period has
+// elapsed (or another signal is received). The teardown workflow still
+// runs after that, and a further signal cancels it.
+func shutdown(r *model.Runner, gracePeriod time.Duration, cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-signals
+	log.Printf("received %s, stopping run (waiting up to %s for in-flight queries)", sig, gracePeriod)
+	r.Stop()
+
+	select {
+	case <-time.After(gracePeriod):
+	case <-signals:
+	}
+
+	log.Printf("cancelling in-flight queries")
+	cancel()
+
+	<-signals
+	log.Printf("cancelling teardown workflow")
+	r.CancelTeardown()
+}
+
+func monitor(r *model.Runner, e model.EnvironmentVariables, printer *monitoring.Printer, percentiles []float64, thresholds []model.Threshold, meta monitoring.ReportMetadata, summary chan int) {
 	events := r.GetEventStream()
 	printTicks := time.Tick(time.Second)
 
-	errors := map[string]int{}
-	counts := map[string]int{}
-	latencies := map[string]*ring.Ring[time.Duration]{}
+	stats := monitoring.NewStats(e.AverageWindowSize)
 
 	for {
 		select {
 		case event := <-events:
-			key := fmt.Sprintf("%s.%s", event.Workflow, event.Name)
-
-			// Increment counts.
-			if event.Err != nil {
-				errors[key]++
+			recordEvent(stats, event)
 
-				monitoring.MetricErrorCount.
-					With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).Inc()
+		case <-printTicks:
+			printer.Print(stats.Interval())
 
-				monitoring.MetricErrorDuration.
-					With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).
-					Observe(event.Duration.Seconds())
-			} else {
-				counts[key]++
+			// Stop the run early if an abortable threshold has been breached.
+			if meta.AbortedBy == "" && lo.SomeBy(thresholds, func(t model.Threshold) bool { return t.Abort }) {
+				snapshot := stats.Cumulative()
+				if breached, ok := monitoring.ThresholdBreached(monitoring.EvaluateThresholds(thresholds, snapshot), snapshot); ok {
+					log.Printf("threshold breached, stopping run: %s", breached.Threshold)
 
-				monitoring.MetricRequestCount.
-					With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).Inc()
+					meta.AbortedBy = breached.Threshold.String()
+					r.Stop()
+				}
+			}
 
-				monitoring.MetricRequestDuration.
-					With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).
-					Observe(event.Duration.Seconds())
+		case <-summary:
+			// Record any events published as the run finished.
+			for len(events) > 0 {
+				recordEvent(stats, <-events)
 			}
 
-			// Add to event latencies.
-			if _, ok := latencies[key]; !ok {
-				latencies[key] = ring.New[time.Duration](e.AverageWindowSize)
+			snapshot := stats.Cumulative()
+			printer.Print(snapshot)
+
+			results := monitoring.EvaluateThresholds(thresholds, snapshot)
+			if len(results) > 0 {
+				printer.PrintThresholds(results)
 			}
-			latencies[key].Add(event.Duration)
 
-		case <-printTicks:
-			printer.Print(counts, errors, latencies)
+			if e.Report != "" {
+				meta.Finished = time.Now()
+				report := monitoring.NewReport(meta, snapshot, percentiles, results)
 
-		case <-summary:
-			printer.Print(counts, errors, latencies)
+				if err := monitoring.WriteReport(e.Report, report); err != nil {
+					log.Printf("error writing report: %v", err)
+				}
+			}
 
 			// Allow the app to finish (the caller will be waiting on this).
-			summary <- struct{}{}
+			switch {
+			case meta.AbortedBy != "":
+				summary <- exitCodeThresholdsAborted
+			case !monitoring.ThresholdsPassed(results):
+				summary <- exitCodeThresholdsFailed
+			case !monitoring.ChecksPassed(snapshot):
+				summary <- exitCodeChecksFailed
+			default:
+				summary <- exitCodeOK
+			}
 		}
 	}
 }
 
-func loadConfig(path, raw string) (*model.Drk, error) {
-	var r io.ReadCloser
+// recordEvent adds an event to the run's statistics and metrics.
+func recordEvent(stats *monitoring.Stats, event model.Event) {
+	stats.Record(event)
+
+	if event.Check != nil {
+		if event.Check.Violation != "" {
+			monitoring.MetricCheckViolationCount.
+				With(prometheus.Labels{"check": event.Check.Name}).Inc()
+		}
+		return
+	}
+
+	if event.Transition != nil {
+		monitoring.MetricTransitionCount.
+			With(prometheus.Labels{"workflow": event.Workflow, "from": event.Transition.From, "to": event.Transition.To}).Inc()
+		return
+	}
+
+	if event.Expected {
+		monitoring.MetricExpectedErrorCount.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).Inc()
+		return
+	}
+
+	if event.AssertionFailed {
+		monitoring.MetricAssertionFailureCount.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).Inc()
+		return
+	}
+
+	if event.Err != nil {
+		class := repo.Classify(event.Err)
+		monitoring.MetricErrorCount.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name, "category": string(class.Category), "code": class.Code}).Inc()
+
+		monitoring.MetricErrorDuration.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).
+			Observe(event.ResponseTime.Seconds())
+	} else {
+		monitoring.MetricRequestCount.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).Inc()
+
+		monitoring.MetricRequestDuration.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).
+			Observe(event.ResponseTime.Seconds())
+
+		monitoring.MetricRequestServiceTime.
+			With(prometheus.Labels{"workflow": event.Workflow, "query": event.Name}).
+			Observe(event.ServiceTime.Seconds())
+	}
+}
+
+// loadConfig parses the config file (or raw config) and returns it,
+// along with a hash of its contents.
+func loadConfig(path, raw string) (*model.Drk, string, error) {
+	var data []byte
 	var err error
 
 	if raw != "" {
-		config, err := base64.StdEncoding.DecodeString(raw)
+		data, err = base64.StdEncoding.DecodeString(raw)
 		if err != nil {
-			return nil, fmt.Errorf("parsing base64 config: %w", err)
+			return nil, "", fmt.Errorf("parsing base64 config: %w", err)
 		}
-		r = io.NopCloser(strings.NewReader(string(config)))
 	} else {
-		r, err = os.Open(path)
+		data, err = os.ReadFile(path)
 		if err != nil {
-			return nil, fmt.Errorf("opening file: %w", err)
+			return nil, "", fmt.Errorf("opening file: %w", err)
 		}
 	}
-	defer r.Close()
 
 	var cfg model.Drk
-	if err = yaml.NewDecoder(r).Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("parsing file: %w", err)
+	if err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&cfg); err != nil {
+		return nil, "", fmt.Errorf("parsing file: %w", err)
 	}
 
-	return &cfg, nil
+	hash := sha256.Sum256(data)
+	return &cfg, hex.EncodeToString(hash[:]), nil
 }
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ArrayFormat determines how an array arg is bound to a query.
+type ArrayFormat string
+
+const (
+	// ArrayFormatNative binds arrays as typed slices, for drivers that
+	// support array types natively (pgx and spanner).
+	ArrayFormatNative ArrayFormat = "native"
+
+	// ArrayFormatJSON binds arrays as JSON strings.
+	ArrayFormatJSON ArrayFormat = "json"
+
+	// ArrayFormatDelimited binds arrays as delimited strings.
+	ArrayFormatDelimited ArrayFormat = "delimited"
+
+	defaultArrayDelimiter = ","
+)
+
+// defaultArrayFormat returns the format arrays are bound in for a
+// driver, if not otherwise specified.
+func defaultArrayFormat(driver string) ArrayFormat {
+	switch driver {
+	case "mysql", "oracle":
+		return ArrayFormatJSON
+	default:
+		return ArrayFormatNative
+	}
+}
+
+// parseArgTypeArray parses an array arg, returning the name of the
+// query its elements reference (if any) alongside its functions.
+func parseArgTypeArray(raw map[string]any) (genFunc, dependencyFunc, string, error) {
+	min, max, err := parseMinMax[int](raw)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if min < 0 || min > max {
+		return nil, nil, "", fmt.Errorf("invalid array size: min (%d) should be between 0 and max (%d)", min, max)
+	}
+
+	innerRaw, err := parseArrayElementArg(raw)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var inner Arg
+	if err = inner.parse(innerRaw); err != nil {
+		return nil, nil, "", fmt.Errorf("parsing array element arg: %w", err)
+	}
+
+	format, err := parseField[string](raw, "format")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, "", fmt.Errorf("parsing format: %w", err)
+		}
+	}
+
+	switch ArrayFormat(format) {
+	case "", ArrayFormatNative, ArrayFormatJSON, ArrayFormatDelimited:
+	default:
+		return nil, nil, "", fmt.Errorf("invalid array format: %q (should be one of: %s, %s, %s)", format, ArrayFormatNative, ArrayFormatJSON, ArrayFormatDelimited)
+	}
+
+	delimiter, err := parseField[string](raw, "delimiter")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, "", fmt.Errorf("parsing delimiter: %w", err)
+		}
+		delimiter = defaultArrayDelimiter
+	}
+
+	genFunc := func(vu *VU) (any, error) {
+		elements := make([]any, Int(min, max+1))
+
+		for i := range elements {
+			element, err := inner.generator(vu)
+			if err != nil {
+				return nil, fmt.Errorf("generating array element: %w", err)
+			}
+			elements[i] = element
+		}
+
+		f := ArrayFormat(format)
+		if f == "" {
+			f = defaultArrayFormat(vu.r.driver)
+		}
+
+		return bindArray(elements, f, delimiter)
+	}
+
+	return genFunc, inner.dependencyCheck, inner.refQuery, nil
+}
+
+// parseArrayElementArg returns the definition of the arg used to
+// generate an array's elements, given either as a nested "arg" or, as
+// a shorthand for gen args, a "value".
+func parseArrayElementArg(raw map[string]any) (map[string]any, error) {
+	if value, ok := raw["value"]; ok {
+		return map[string]any{"type": "gen", "value": value}, nil
+	}
+
+	arg, err := parseField[map[string]any](raw, "arg")
+	if err != nil {
+		return nil, fmt.Errorf("parsing arg: %w", err)
+	}
+
+	return arg, nil
+}
+
+// bindArray converts array elements into a value that can be bound to
+// a query in the given format.
+func bindArray(elements []any, format ArrayFormat, delimiter string) (any, error) {
+	switch format {
+	case ArrayFormatJSON:
+		b, err := json.Marshal(elements)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling array: %w", err)
+		}
+		return string(b), nil
+
+	case ArrayFormatDelimited:
+		parts := make([]string, len(elements))
+		for i, e := range elements {
+			parts[i] = fmt.Sprint(e)
+		}
+		return strings.Join(parts, delimiter), nil
+
+	default:
+		return typedSlice(elements), nil
+	}
+}
+
+// typedSlice converts a slice of elements into a slice of their common
+// type, as drivers can only bind typed slices as native arrays.
+// Elements without a common type are returned as-is.
+func typedSlice(elements []any) any {
+	if len(elements) == 0 {
+		return []string{}
+	}
+
+	switch elements[0].(type) {
+	case string:
+		return convertSlice(elements, func(e any) (string, bool) {
+			v, ok := e.(string)
+			return v, ok
+		})
+
+	case int, int32, int64:
+		return convertSlice(elements, func(e any) (int64, bool) {
+			switch v := e.(type) {
+			case int:
+				return int64(v), true
+			case int32:
+				return int64(v), true
+			case int64:
+				return v, true
+			default:
+				return 0, false
+			}
+		})
+
+	case float32, float64:
+		return convertSlice(elements, func(e any) (float64, bool) {
+			switch v := e.(type) {
+			case float32:
+				return float64(v), true
+			case float64:
+				return v, true
+			default:
+				return 0, false
+			}
+		})
+
+	case bool:
+		return convertSlice(elements, func(e any) (bool, bool) {
+			v, ok := e.(bool)
+			return v, ok
+		})
+
+	case time.Time:
+		return convertSlice(elements, func(e any) (time.Time, bool) {
+			v, ok := e.(time.Time)
+			return v, ok
+		})
+
+	default:
+		return elements
+	}
+}
+
+func convertSlice[T any](elements []any, convert func(any) (T, bool)) any {
+	typed := make([]T, len(elements))
+
+	for i, e := range elements {
+		v, ok := convert(e)
+		if !ok {
+			return elements
+		}
+		typed[i] = v
+	}
+
+	return typed
+}
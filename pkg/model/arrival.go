@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Arrival determines how the executions of a workflow query are
+// scheduled within its rate.
+type Arrival string
+
+const (
+	// ArrivalConstant executes queries at perfectly regular intervals,
+	// waiting for the previous execution to complete before starting
+	// the next (closed model).
+	ArrivalConstant Arrival = "constant"
+
+	// ArrivalPoisson executes queries with exponentially distributed
+	// inter-arrival times, without waiting for the previous execution
+	// to complete (open model).
+	ArrivalPoisson Arrival = "poisson"
+
+	// ArrivalUniform executes queries with uniformly distributed
+	// inter-arrival times, without waiting for the previous execution
+	// to complete (open model).
+	ArrivalUniform Arrival = "uniform"
+)
+
+func (a *Arrival) UnmarshalYAML(node *yaml.Node) error {
+	switch arrival := Arrival(node.Value); arrival {
+	case ArrivalConstant, ArrivalPoisson, ArrivalUniform:
+		*a = arrival
+		return nil
+
+	default:
+		return fmt.Errorf("invalid arrival: %q (should be one of: %s, %s, %s)", node.Value, ArrivalConstant, ArrivalPoisson, ArrivalUniform)
+	}
+}
+
+// open returns true if executions are dispatched without waiting
+// for previous executions to complete.
+func (a Arrival) open() bool {
+	return a == ArrivalPoisson || a == ArrivalUniform
+}
+
+// next returns the time to wait before the next execution, given
+// the mean interval between executions.
+func (a Arrival) next(mean time.Duration) time.Duration {
+	switch a {
+	case ArrivalPoisson:
+		return time.Duration(rand.ExpFloat64() * float64(mean))
+
+	case ArrivalUniform:
+		return Interval(0, mean*2)
+
+	default:
+		return mean
+	}
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestArrivalUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    Arrival
+		expErr error
+	}{
+		{
+			name: "constant",
+			yaml: "arrival: constant",
+			exp:  ArrivalConstant,
+		},
+		{
+			name: "poisson",
+			yaml: "arrival: poisson",
+			exp:  ArrivalPoisson,
+		},
+		{
+			name: "uniform",
+			yaml: "arrival: uniform",
+			exp:  ArrivalUniform,
+		},
+		{
+			name:   "invalid",
+			yaml:   "arrival: invalid",
+			expErr: fmt.Errorf("invalid arrival: \"invalid\" (should be one of: constant, poisson, uniform)"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var wq WorkflowQuery
+			err := yaml.Unmarshal([]byte(c.yaml), &wq)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, c.exp, wq.Arrival)
+		})
+	}
+}
+
+func TestArrivalNext(t *testing.T) {
+	cases := []struct {
+		name    string
+		arrival Arrival
+		mean    time.Duration
+		expFunc func(t *testing.T, val time.Duration)
+	}{
+		{
+			name:    "default",
+			arrival: "",
+			mean:    time.Second,
+			expFunc: func(t *testing.T, val time.Duration) {
+				assert.Equal(t, time.Second, val)
+			},
+		},
+		{
+			name:    "constant",
+			arrival: ArrivalConstant,
+			mean:    time.Second,
+			expFunc: func(t *testing.T, val time.Duration) {
+				assert.Equal(t, time.Second, val)
+			},
+		},
+		{
+			name:    "poisson",
+			arrival: ArrivalPoisson,
+			mean:    time.Second,
+			expFunc: func(t *testing.T, val time.Duration) {
+				assert.GreaterOrEqual(t, val, time.Duration(0))
+			},
+		},
+		{
+			name:    "uniform",
+			arrival: ArrivalUniform,
+			mean:    time.Second,
+			expFunc: func(t *testing.T, val time.Duration) {
+				test.NumberBetween(t, val, 0, time.Second*2)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act := c.arrival.next(c.mean)
+			c.expFunc(t, act)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// Assertion checks the rows returned by a query.
+type Assertion struct {
+	Rows    *RowBounds `yaml:"rows"`
+	NotNull []string   `yaml:"not_null"`
+
+	// Equals maps columns to the args (by position or name) that every
+	// row's value for the column should equal.
+	Equals map[string]any `yaml:"equals"`
+
+	// Expr is an expression over the rows (and args) that should
+	// evaluate to true.
+	Expr    string `yaml:"expr"`
+	program *vm.Program
+}
+
+// RowBounds are the minimum and maximum number of rows a query should
+// return, either of which can be omitted. A single number sets both.
+type RowBounds struct {
+	Min *int `yaml:"min"`
+	Max *int `yaml:"max"`
+}
+
+func (b *RowBounds) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var n int
+		if err := node.Decode(&n); err != nil {
+			return err
+		}
+
+		*b = RowBounds{Min: &n, Max: &n}
+		return nil
+	}
+
+	type rawRowBounds RowBounds
+
+	var raw rawRowBounds
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	if raw.Min != nil && raw.Max != nil && *raw.Min > *raw.Max {
+		return fmt.Errorf("invalid row bounds: min %d is greater than max %d", *raw.Min, *raw.Max)
+	}
+
+	*b = RowBounds(raw)
+	return nil
+}
+
+func (a *Assertion) UnmarshalYAML(node *yaml.Node) error {
+	type rawAssertion Assertion
+
+	var raw rawAssertion
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	// Column names are lower-cased when rows are read.
+	for i, column := range raw.NotNull {
+		raw.NotNull[i] = strings.ToLower(column)
+	}
+
+	equals := make(map[string]any, len(raw.Equals))
+	for column, key := range raw.Equals {
+		switch key.(type) {
+		case int, string:
+		default:
+			return fmt.Errorf("invalid equals arg for %q: %v (should be an index or name)", column, key)
+		}
+		equals[strings.ToLower(column)] = key
+	}
+	raw.Equals = equals
+
+	if raw.Expr != "" {
+		program, err := expr.Compile(raw.Expr, expr.Env(assertionEnv(nil, nil, nil, nil)), expr.AsBool())
+		if err != nil {
+			return fmt.Errorf("compiling assertion expr: %w", err)
+		}
+		raw.program = program
+	}
+
+	*a = Assertion(raw)
+	return nil
+}
+
+// validateAssertions returns an error if an assertion is given for an
+// activity (or tx statement) that doesn't return rows.
+func validateAssertions(activities map[string]Query) error {
+	validate := func(name string, q Query) error {
+		if q.Assert != nil && q.Type != "query" {
+			return fmt.Errorf("assert is only supported by query activities: %q is %q", name, q.Type)
+		}
+		return nil
+	}
+
+	for name, q := range activities {
+		if err := validate(name, q); err != nil {
+			return err
+		}
+
+		for _, stmt := range q.Statements {
+			if err := validate(name+"."+stmt.Name, stmt.Query); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AssertionError is returned when the rows returned by a query fail
+// its assertion.
+type AssertionError struct {
+	Reason string
+}
+
+func (e *AssertionError) Error() string {
+	return "assertion failed: " + e.Reason
+}
+
+func isAssertionError(err error) bool {
+	var assertErr *AssertionError
+	return errors.As(err, &assertErr)
+}
+
+// check returns an AssertionError if the rows returned by a query fail
+// the assertion, given the args generated for the query.
+func (a *Assertion) check(vu *VU, args []any, named map[string]any, rows []map[string]any) error {
+	fail := func(format string, v ...any) error {
+		return &AssertionError{Reason: fmt.Sprintf(format, v...)}
+	}
+
+	if a.Rows != nil {
+		if a.Rows.Min != nil && len(rows) < *a.Rows.Min {
+			return fail("expected at least %d rows, got %d", *a.Rows.Min, len(rows))
+		}
+		if a.Rows.Max != nil && len(rows) > *a.Rows.Max {
+			return fail("expected at most %d rows, got %d", *a.Rows.Max, len(rows))
+		}
+	}
+
+	for i, row := range rows {
+		for _, column := range a.NotNull {
+			value, ok := row[column]
+			if !ok {
+				return fail("missing column %q", column)
+			}
+			if value == nil {
+				return fail("column %q is null in row %d", column, i)
+			}
+		}
+	}
+
+	columns := lo.Keys(a.Equals)
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		expected, err := assertionArg(a.Equals[column], args, named)
+		if err != nil {
+			return fmt.Errorf("checking %q: %w", column, err)
+		}
+
+		for i, row := range rows {
+			value, ok := row[column]
+			if !ok {
+				return fail("missing column %q", column)
+			}
+			if !equalValues(value, expected) {
+				return fail("column %q is %v in row %d, expected %v", column, normalizeValue(value), i, normalizeValue(expected))
+			}
+		}
+	}
+
+	if a.program != nil {
+		ok, err := expr.Run(a.program, assertionEnv(vu, args, named, rows))
+		if err != nil {
+			return fmt.Errorf("running assertion expr: %w", err)
+		}
+		if ok != true {
+			return fail("expr is false: %s", a.Expr)
+		}
+	}
+
+	return nil
+}
+
+// assertionEnv extends the environment of expr args with the rows
+// returned by a query and the args generated for it.
+func assertionEnv(vu *VU, args []any, named map[string]any, rows []map[string]any) map[string]any {
+	env := exprEnv(vu)
+	if vu != nil {
+		call := vu.forCall()
+		call.args = args
+		maps.Copy(call.namedArgs, named)
+		env["arg"] = call.arg
+	}
+
+	env["rows"] = rows
+	env["args"] = args
+	return env
+}
+
+func assertionArg(key any, args []any, named map[string]any) (any, error) {
+	switch k := key.(type) {
+	case int:
+		if k < 0 || k >= len(args) {
+			return nil, fmt.Errorf("missing arg: %d (query has %d)", k, len(args))
+		}
+		return args[k], nil
+
+	default:
+		value, ok := named[k.(string)]
+		if !ok {
+			return nil, fmt.Errorf("missing arg: %q", k)
+		}
+		return value, nil
+	}
+}
+
+// equalValues compares a value read from the database with one that
+// was generated, which can differ in type (e.g. int64 and int, or
+// []byte and string) while representing the same value.
+func equalValues(a, b any) bool {
+	return fmt.Sprint(normalizeValue(a)) == fmt.Sprint(normalizeValue(b))
+}
+
+func normalizeValue(v any) any {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
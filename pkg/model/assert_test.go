@@ -0,0 +1,170 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAssertionCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		args   []any
+		named  map[string]any
+		rows   []map[string]any
+		expErr string
+	}{
+		{
+			name: "exact rows",
+			yaml: `rows: 1`,
+			rows: []map[string]any{{"id": 1}},
+		},
+		{
+			name:   "too few rows",
+			yaml:   `rows: {min: 1}`,
+			expErr: "assertion failed: expected at least 1 rows, got 0",
+		},
+		{
+			name:   "too many rows",
+			yaml:   `rows: {max: 1}`,
+			rows:   []map[string]any{{"id": 1}, {"id": 2}},
+			expErr: "assertion failed: expected at most 1 rows, got 2",
+		},
+		{
+			name: "not null",
+			yaml: `not_null: [ID, email]`,
+			rows: []map[string]any{{"id": 1, "email": "a@example.com"}},
+		},
+		{
+			name:   "null",
+			yaml:   `not_null: [email]`,
+			rows:   []map[string]any{{"email": "a@example.com"}, {"email": nil}},
+			expErr: "assertion failed: column \"email\" is null in row 1",
+		},
+		{
+			name:   "missing column",
+			yaml:   `not_null: [name]`,
+			rows:   []map[string]any{{"email": "a@example.com"}},
+			expErr: "assertion failed: missing column \"name\"",
+		},
+		{
+			name: "equals positional arg",
+			yaml: `equals: {id: 0, email: 1}`,
+			args: []any{1, "a@example.com"},
+			rows: []map[string]any{{"id": int64(1), "email": []byte("a@example.com")}},
+		},
+		{
+			name:  "equals named arg",
+			yaml:  `equals: {email: email}`,
+			named: map[string]any{"email": "a@example.com"},
+			rows:  []map[string]any{{"email": "a@example.com"}},
+		},
+		{
+			name:   "not equal",
+			yaml:   `equals: {email: 0}`,
+			args:   []any{"a@example.com"},
+			rows:   []map[string]any{{"email": "b@example.com"}},
+			expErr: "assertion failed: column \"email\" is b@example.com in row 0, expected a@example.com",
+		},
+		{
+			name: "expr",
+			yaml: `expr: all(rows, .balance >= 0) && len(rows) == arg(0)`,
+			args: []any{2},
+			rows: []map[string]any{{"balance": 10}, {"balance": 0}},
+		},
+		{
+			name:   "expr false",
+			yaml:   `expr: all(rows, .balance >= 0)`,
+			rows:   []map[string]any{{"balance": 10}, {"balance": -1}},
+			expErr: "assertion failed: expr is false: all(rows, .balance >= 0)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var a Assertion
+			assert.NoError(t, yaml.Unmarshal([]byte(c.yaml), &a))
+
+			err := a.check(NewVU(&Runner{}), c.args, c.named, c.rows)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				assert.True(t, isAssertionError(err))
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAssertionUnmarshalYAMLInvalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		expErr string
+	}{
+		{
+			name:   "row bounds",
+			yaml:   `rows: {min: 2, max: 1}`,
+			expErr: "invalid row bounds: min 2 is greater than max 1",
+		},
+		{
+			name:   "equals arg",
+			yaml:   `equals: {id: [1]}`,
+			expErr: "invalid equals arg for \"id\": [1] (should be an index or name)",
+		},
+		{
+			name:   "non-boolean expr",
+			yaml:   `expr: len(rows)`,
+			expErr: "compiling assertion expr:",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var a Assertion
+			assert.ErrorContains(t, yaml.Unmarshal([]byte(c.yaml), &a), c.expErr)
+		})
+	}
+}
+
+func TestExecActivityAssertionFailed(t *testing.T) {
+	queryer := mockQueryer{
+		query: func(query string, args ...any) ([]map[string]any, time.Duration, error) {
+			return []map[string]any{{"id": nil}}, 0, nil
+		},
+	}
+
+	var query Query
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+type: query
+query: SELECT id FROM t
+assert:
+  not_null: [id]`), &query))
+
+	cfg := &Drk{Activities: map[string]Query{"fetch": query}}
+
+	r, err := NewRunner(cfg, &queryer, EnvironmentVariables{Retries: 3}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	vu := NewVU(r)
+	r.execActivity(context.Background(), vu, "w", "fetch", query, time.Now())
+
+	event := <-r.events
+	assert.True(t, event.AssertionFailed)
+	assert.EqualError(t, event.Err, "assertion failed: column \"id\" is null in row 0")
+	assert.Equal(t, 1, event.Attempts)
+	assert.Empty(t, vu.data["fetch"])
+}
+
+func TestValidateAssertions(t *testing.T) {
+	_, err := NewRunner(&Drk{Activities: map[string]Query{
+		"insert": {Type: "exec", Query: "INSERT INTO t VALUES (1)", Assert: &Assertion{}},
+	}}, &mockQueryer{}, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.EqualError(t, err, "validating assertions: assert is only supported by query activities: \"insert\" is \"exec\"")
+}
@@ -0,0 +1,264 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultCheckInterval = time.Second * 10
+
+	// maxViolationRows bounds the offending rows recorded for a single
+	// violation.
+	maxViolationRows = 10
+)
+
+// Check is a query that's run periodically while the workload runs, to
+// verify that an invariant holds (e.g. that the sum of balances doesn't
+// change, or that there are no orphaned rows).
+type Check struct {
+	Query    string        `yaml:"query"`
+	Interval time.Duration `yaml:"interval"`
+
+	// Expect maps columns to the value every row should have.
+	Expect map[string]any `yaml:"expect"`
+
+	// Unchanged requires every run to return the same rows (in any
+	// order) as the last run whose invariant held.
+	Unchanged bool `yaml:"unchanged"`
+
+	Assert *Assertion `yaml:"assert"`
+
+	// Warn records violations without failing the run.
+	Warn bool `yaml:"warn"`
+}
+
+func (c *Check) UnmarshalYAML(node *yaml.Node) error {
+	type rawCheck Check
+
+	raw := rawCheck{
+		Interval: defaultCheckInterval,
+	}
+
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	if raw.Query == "" {
+		return fmt.Errorf("missing check query")
+	}
+
+	if raw.Interval <= 0 {
+		return fmt.Errorf("invalid check interval: %s (should be greater than zero)", raw.Interval)
+	}
+
+	if len(raw.Expect) == 0 && !raw.Unchanged && raw.Assert == nil {
+		return fmt.Errorf("check has nothing to verify (should have at least one of: expect, unchanged, assert)")
+	}
+
+	// Column names are lower-cased when rows are read.
+	expect := make(map[string]any, len(raw.Expect))
+	for column, value := range raw.Expect {
+		expect[strings.ToLower(column)] = value
+	}
+	raw.Expect = expect
+
+	*c = Check(raw)
+	return nil
+}
+
+// CheckResult is the outcome of a single run of a check.
+type CheckResult struct {
+	Name string
+	Time time.Time
+
+	// Violation describes how the check's invariant was broken, and
+	// Rows the rows that broke it. Violation is empty if the invariant
+	// held.
+	Violation string
+	Rows      []map[string]any
+
+	// Fail is set if violations of the check should fail the run.
+	Fail bool
+}
+
+// checkBaseline holds the rows returned by the last run of a check
+// whose invariant held. A run that returned no rows is still a
+// baseline, so set records whether there has been one.
+type checkBaseline struct {
+	rows []map[string]any
+	set  bool
+}
+
+// verify returns a description of how the rows returned by a check
+// break its invariant, along with the offending rows, or an empty
+// string if the invariant held.
+func (c Check) verify(vu *VU, rows []map[string]any, baseline checkBaseline) (string, []map[string]any, error) {
+	if c.Assert != nil {
+		var assertErr *AssertionError
+		if err := c.Assert.check(vu, nil, nil, rows); errors.As(err, &assertErr) {
+			return assertErr.Reason, rows, nil
+		} else if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if len(c.Expect) > 0 {
+		columns := lo.Keys(c.Expect)
+		sort.Strings(columns)
+
+		var offending []map[string]any
+		var reasons []string
+
+		for i, row := range rows {
+			for _, column := range columns {
+				value, ok := row[column]
+				if !ok {
+					return fmt.Sprintf("missing column %q", column), rows, nil
+				}
+
+				if !equalValues(value, c.Expect[column]) {
+					reasons = append(reasons, fmt.Sprintf("column %q is %v in row %d, expected %v", column, normalizeValue(value), i, c.Expect[column]))
+					offending = append(offending, row)
+					break
+				}
+			}
+		}
+
+		if len(offending) > 0 {
+			return reasons[0] + lo.Ternary(len(reasons) > 1, fmt.Sprintf(" (and %d more rows)", len(reasons)-1), ""), offending, nil
+		}
+	}
+
+	if c.Unchanged && baseline.set {
+		if added, removed := diffRows(rows, baseline.rows); len(added)+len(removed) > 0 {
+			return fmt.Sprintf("rows changed since last passing check (%d added, %d removed)", len(added), len(removed)), append(added, removed...), nil
+		}
+	}
+
+	return "", nil, nil
+}
+
+// diffRows returns the rows in a that aren't in b, and the rows in b
+// that aren't in a, regardless of their order.
+func diffRows(a, b []map[string]any) (added, removed []map[string]any) {
+	counts := map[string]int{}
+	for _, row := range b {
+		counts[canonicalRow(row)]++
+	}
+
+	for _, row := range a {
+		key := canonicalRow(row)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		added = append(added, row)
+	}
+
+	for _, row := range b {
+		key := canonicalRow(row)
+		if counts[key] > 0 {
+			counts[key]--
+			removed = append(removed, row)
+		}
+	}
+
+	return added, removed
+}
+
+// canonicalRow returns a string representation of a row that's the same
+// for rows with equal values, whatever their column order or types.
+func canonicalRow(row map[string]any) string {
+	columns := lo.Keys(row)
+	sort.Strings(columns)
+
+	var sb strings.Builder
+	for _, column := range columns {
+		fmt.Fprintf(&sb, "%q=%q;", column, fmt.Sprint(normalizeValue(row[column])))
+	}
+
+	return sb.String()
+}
+
+// runChecks runs each check at its interval until done is closed, then
+// once more, so that invariants are also verified once the workload
+// has finished.
+func (r *Runner) runChecks(ctx context.Context, done <-chan struct{}) {
+	if r.cfg == nil || len(r.cfg.Checks) == 0 {
+		return
+	}
+
+	db := lo.Ternary(r.checkDB != nil, r.checkDB, r.db)
+
+	var wg sync.WaitGroup
+	for name, check := range r.cfg.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			vu := NewVU(r)
+			vu.workflow = name
+
+			var baseline checkBaseline
+			for {
+				baseline = r.runCheck(ctx, db, vu, name, check, baseline)
+
+				if !wait(check.Interval, done) {
+					r.runCheck(ctx, db, vu, name, check, baseline)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runCheck runs a check and publishes its result, returning the
+// baseline to compare the next run against. This is only replaced by
+// runs whose invariant held, so that a lasting change is reported by
+// every run rather than becoming the new baseline.
+func (r *Runner) runCheck(ctx context.Context, db repo.Queryer, vu *VU, name string, check Check, baseline checkBaseline) checkBaseline {
+	queryCtx, cancel := r.retry.attemptContext(ctx, r.retry.Timeout)
+	defer cancel()
+
+	rows, _, err := db.Query(queryCtx, check.Query)
+	result := CheckResult{Name: name, Time: time.Now(), Fail: !check.Warn}
+
+	if err != nil {
+		if cancelled(ctx, err) {
+			return baseline
+		}
+
+		r.logger.Warn().Str("check", name).Err(err).Msg("running check")
+		r.events <- Event{Check: &result, Err: err}
+		return baseline
+	}
+
+	reason, offending, err := check.verify(vu, rows, baseline)
+	if err != nil {
+		r.logger.Warn().Str("check", name).Err(err).Msg("verifying check")
+		r.events <- Event{Check: &result, Err: err}
+		return baseline
+	}
+
+	if reason != "" {
+		result.Violation = reason
+		result.Rows = offending[:min(len(offending), maxViolationRows)]
+
+		r.logger.Warn().Str("check", name).Str("violation", reason).Any("rows", result.Rows).Msg("check violated")
+	}
+
+	r.events <- Event{Check: &result}
+	return lo.Ternary(reason == "", checkBaseline{rows: rows, set: true}, baseline)
+}
@@ -0,0 +1,248 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    Check
+		expErr string
+	}{
+		{
+			name: "defaults",
+			yaml: `
+query: SELECT SUM(balance) AS total FROM account
+expect:
+  TOTAL: 1000`,
+			exp: Check{
+				Query:    "SELECT SUM(balance) AS total FROM account",
+				Interval: defaultCheckInterval,
+				Expect:   map[string]any{"total": 1000},
+			},
+		},
+		{
+			name: "overrides",
+			yaml: `
+query: SELECT id FROM account ORDER BY id
+interval: 1s
+unchanged: true
+warn: true`,
+			exp: Check{
+				Query:     "SELECT id FROM account ORDER BY id",
+				Interval:  time.Second,
+				Expect:    map[string]any{},
+				Unchanged: true,
+				Warn:      true,
+			},
+		},
+		{
+			name:   "missing query",
+			yaml:   `unchanged: true`,
+			expErr: "missing check query",
+		},
+		{
+			name: "invalid interval",
+			yaml: `
+query: SELECT 1
+interval: 0s
+unchanged: true`,
+			expErr: "invalid check interval: 0s (should be greater than zero)",
+		},
+		{
+			name:   "nothing to verify",
+			yaml:   `query: SELECT 1`,
+			expErr: "check has nothing to verify (should have at least one of: expect, unchanged, assert)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var act Check
+			err := yaml.Unmarshal([]byte(c.yaml), &act)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestCheckVerify(t *testing.T) {
+	one := 1
+
+	cases := []struct {
+		name         string
+		check        Check
+		rows         []map[string]any
+		baseline     checkBaseline
+		expReason    string
+		expOffending []map[string]any
+	}{
+		{
+			name:  "expect holds",
+			check: Check{Expect: map[string]any{"total": 1000}},
+			rows:  []map[string]any{{"total": int64(1000)}},
+		},
+		{
+			name:         "expect violated",
+			check:        Check{Expect: map[string]any{"orphans": 0}},
+			rows:         []map[string]any{{"orphans": int64(0)}, {"orphans": int64(2)}, {"orphans": int64(3)}},
+			expReason:    `column "orphans" is 2 in row 1, expected 0 (and 1 more rows)`,
+			expOffending: []map[string]any{{"orphans": int64(2)}, {"orphans": int64(3)}},
+		},
+		{
+			name:         "expect missing column",
+			check:        Check{Expect: map[string]any{"total": 1000}},
+			rows:         []map[string]any{{"sum": int64(1000)}},
+			expReason:    `missing column "total"`,
+			expOffending: []map[string]any{{"sum": int64(1000)}},
+		},
+		{
+			name:  "unchanged first run",
+			check: Check{Unchanged: true},
+			rows:  []map[string]any{{"id": int64(1)}},
+		},
+		{
+			name:     "unchanged holds",
+			check:    Check{Unchanged: true},
+			rows:     []map[string]any{{"id": []byte("a")}},
+			baseline: checkBaseline{rows: []map[string]any{{"id": "a"}}, set: true},
+		},
+		{
+			name:     "unchanged in a different order",
+			check:    Check{Unchanged: true},
+			rows:     []map[string]any{{"id": int64(2), "name": "b"}, {"id": int64(1), "name": "a"}, {"id": int64(1), "name": "a"}},
+			baseline: checkBaseline{rows: []map[string]any{{"id": int64(1), "name": "a"}, {"id": int64(1), "name": []byte("a")}, {"id": int64(2), "name": "b"}}, set: true},
+		},
+		{
+			name:         "unchanged violated by added row",
+			check:        Check{Unchanged: true},
+			rows:         []map[string]any{{"id": int64(2)}, {"id": int64(1)}},
+			baseline:     checkBaseline{rows: []map[string]any{{"id": int64(1)}}, set: true},
+			expReason:    "rows changed since last passing check (1 added, 0 removed)",
+			expOffending: []map[string]any{{"id": int64(2)}},
+		},
+		{
+			name:         "unchanged violated by changed and duplicate rows",
+			check:        Check{Unchanged: true},
+			rows:         []map[string]any{{"id": int64(1)}, {"id": int64(1)}, {"id": int64(3)}},
+			baseline:     checkBaseline{rows: []map[string]any{{"id": int64(2)}, {"id": int64(1)}, {"id": int64(3)}}, set: true},
+			expReason:    "rows changed since last passing check (1 added, 1 removed)",
+			expOffending: []map[string]any{{"id": int64(1)}, {"id": int64(2)}},
+		},
+		{
+			name:         "unchanged from zero rows",
+			check:        Check{Unchanged: true},
+			rows:         []map[string]any{{"id": int64(1)}},
+			baseline:     checkBaseline{set: true},
+			expReason:    "rows changed since last passing check (1 added, 0 removed)",
+			expOffending: []map[string]any{{"id": int64(1)}},
+		},
+		{
+			name:         "assert violated",
+			check:        Check{Assert: &Assertion{Rows: &RowBounds{Max: &one}}},
+			rows:         []map[string]any{{"id": int64(1)}, {"id": int64(1)}},
+			expReason:    "expected at most 1 rows, got 2",
+			expOffending: []map[string]any{{"id": int64(1)}, {"id": int64(1)}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reason, offending, err := c.check.verify(nil, c.rows, c.baseline)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expReason, reason)
+			assert.Equal(t, c.expOffending, offending)
+		})
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	total := int64(1000)
+	var queryErr error
+
+	queryer := mockQueryer{
+		query: func(query string, args ...any) ([]map[string]any, time.Duration, error) {
+			return []map[string]any{{"total": total}}, time.Millisecond, queryErr
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	check := Check{Query: "SELECT SUM(balance) AS total FROM account", Expect: map[string]any{"total": 1000}, Unchanged: true}
+	vu := NewVU(r)
+
+	baseline := r.runCheck(context.Background(), &queryer, vu, "balances", check, checkBaseline{})
+	event := <-r.events
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "balances", event.Check.Name)
+	assert.Empty(t, event.Check.Violation)
+	assert.True(t, event.Check.Fail)
+
+	// A violation keeps the last passing rows as the baseline, so that a
+	// lasting change is reported by every run.
+	check.Expect = nil
+	total = 999
+	for range 2 {
+		assert.Equal(t, baseline, r.runCheck(context.Background(), &queryer, vu, "balances", check, baseline))
+		event = <-r.events
+		assert.Equal(t, "rows changed since last passing check (1 added, 1 removed)", event.Check.Violation)
+		assert.Equal(t, []map[string]any{{"total": int64(999)}, {"total": int64(1000)}}, event.Check.Rows)
+	}
+
+	check.Expect = map[string]any{"total": 1000}
+	baseline = r.runCheck(context.Background(), &queryer, vu, "balances", check, checkBaseline{})
+	event = <-r.events
+	assert.Equal(t, `column "total" is 999 in row 0, expected 1000`, event.Check.Violation)
+	assert.Equal(t, []map[string]any{{"total": int64(999)}}, event.Check.Rows)
+	assert.False(t, baseline.set)
+
+	queryErr = fmt.Errorf("connection refused")
+	assert.Equal(t, baseline, r.runCheck(context.Background(), &queryer, vu, "balances", check, baseline))
+	event = <-r.events
+	assert.Equal(t, queryErr, event.Err)
+	assert.Empty(t, event.Check.Violation)
+}
+
+func TestRunCheckUnchangedFromZeroRows(t *testing.T) {
+	var rows []map[string]any
+
+	queryer := mockQueryer{
+		query: func(query string, args ...any) ([]map[string]any, time.Duration, error) {
+			return rows, time.Millisecond, nil
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	check := Check{Query: "SELECT id FROM order_item WHERE order_id NOT IN (SELECT id FROM orders)", Unchanged: true}
+	vu := NewVU(r)
+
+	// A run that returns no rows is a baseline, so rows that appear later
+	// are reported.
+	baseline := r.runCheck(context.Background(), &queryer, vu, "orphans", check, checkBaseline{})
+	event := <-r.events
+	assert.Empty(t, event.Check.Violation)
+	assert.True(t, baseline.set)
+
+	rows = []map[string]any{{"id": int64(1)}}
+	assert.Equal(t, baseline, r.runCheck(context.Background(), &queryer, vu, "orphans", check, baseline))
+	event = <-r.events
+	assert.Equal(t, "rows changed since last passing check (1 added, 0 removed)", event.Check.Violation)
+	assert.Equal(t, rows, event.Check.Rows)
+}
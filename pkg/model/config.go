@@ -1,11 +1,14 @@
 package model
 
 import (
+	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/samber/lo"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,12 +21,15 @@ type EnvironmentVariables struct {
 	Duration           time.Duration `env:"DURATION"`
 	Retries            int           `env:"RETRIES"`
 	QueryTimeout       time.Duration `env:"QUERY_TIMEOUT"`
+	GracePeriod        time.Duration `env:"GRACE_PERIOD"`
+	TeardownTimeout    time.Duration `env:"TEARDOWN_TIMEOUT"`
 	Debug              bool          `env:"DEBUG"`
 	Errors             bool          `env:"NO_ERRORS"`
 	Sensitive          bool          `env:"SENSITIVE"`
 	AverageWindowSize  int           `env:"AVERAGE_WINDOW_SIZE"`
 	NoColor            bool          `env:"NO_COLOR"`
 	ConnectionLifetime time.Duration `env:"CONNECTION_LIFETIME"`
+	Report             string        `env:"REPORT"`
 }
 
 type genFunc func(*VU) (any, error)
@@ -33,10 +39,12 @@ type dependencyFunc func(*VU) bool
 func dependencyFuncNoop(*VU) bool { return true }
 
 type Drk struct {
-	GlobalArgs  map[string]Arg        `yaml:"args"`
+	GlobalArgs  GlobalArgs            `yaml:"args"`
 	EnvMappings map[string]EnvMapping `yaml:"arg_mappings"`
 	Workflows   map[string]Workflow   `yaml:"workflows"`
 	Activities  map[string]Query      `yaml:"activities"`
+	Thresholds  []Threshold           `yaml:"thresholds"`
+	Checks      map[string]Check      `yaml:"checks"`
 }
 
 // MaxVUsRequired returns number of VUs required by the busiest workload.
@@ -47,6 +55,12 @@ func (d *Drk) MaxVUsRequired() int {
 		if max < v.Vus {
 			max = v.Vus
 		}
+
+		for _, stage := range v.Stages {
+			if max < stage.Vus {
+				max = stage.Vus
+			}
+		}
 	}
 
 	return max
@@ -57,14 +71,158 @@ type EnvMapping map[string]string
 type envMappingGenerator func(env, value string) (string, bool)
 
 type WorkflowQuery struct {
-	Name string `yaml:"name"`
-	Rate Rate   `yaml:"rate"`
+	Name    string  `yaml:"name"`
+	Rate    Rate    `yaml:"rate"`
+	Arrival Arrival `yaml:"arrival"`
+
+	// Used by sequence and markov workflows.
+	ThinkTime ThinkTime `yaml:"think_time"`
+	Repeat    int       `yaml:"repeat"`
+
+	// Used by markov workflows.
+	Next Transitions `yaml:"next"`
 }
 
 type Query struct {
 	Type  string `yaml:"type"`
-	Args  []Arg  `yaml:"args"`
+	Args  Args   `yaml:"args"`
 	Query string `yaml:"query"`
+
+	// Template renders Query as a text/template before each execution,
+	// allowing its structure to vary.
+	Template bool `yaml:"template"`
+
+	// Retry overrides the default retry policy, which retries any
+	// error up to --retries times.
+	Retry *RetryPolicy `yaml:"retry"`
+
+	// Assert checks the rows returned by "query" activities and
+	// statements.
+	Assert *Assertion `yaml:"assert"`
+
+	// ExpectErrors lists the errors the activity is expected to
+	// encounter, which are counted separately from its errors.
+	ExpectErrors ExpectedErrors `yaml:"expect_errors"`
+
+	// Dialects override Query (and optionally Args) for specific
+	// drivers, keyed by driver name.
+	Dialects map[string]Dialect `yaml:"dialects"`
+
+	// Tx and Statements are used by "tx" queries, which run each of
+	// their statements, in order, within a single transaction.
+	Tx         *TxConfig     `yaml:"tx"`
+	Statements []TxStatement `yaml:"statements"`
+}
+
+// TxStatement is a named query that runs as part of a transaction. Any
+// rows returned by the statement are available to the statements that
+// follow it via "ref" args using the statement's name.
+type TxStatement struct {
+	Name  string `yaml:"name"`
+	Query `yaml:",inline"`
+}
+
+// TxConfig configures the transaction of a "tx" query.
+type TxConfig struct {
+	Isolation  Isolation            `yaml:"isolation"`
+	Retry      repo.TxRetryStrategy `yaml:"retry"`
+	MaxRetries int                  `yaml:"max_retries"`
+}
+
+const (
+	defaultTxMaxRetries = 3
+)
+
+func (c *TxConfig) UnmarshalYAML(node *yaml.Node) error {
+	type rawTxConfig TxConfig
+
+	raw := rawTxConfig{
+		Retry:      repo.TxRetryRestart,
+		MaxRetries: defaultTxMaxRetries,
+	}
+
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	switch raw.Retry {
+	case repo.TxRetryRestart, repo.TxRetrySavepoint:
+	default:
+		return fmt.Errorf("invalid tx retry strategy: %q (should be one of: %s, %s)", raw.Retry, repo.TxRetryRestart, repo.TxRetrySavepoint)
+	}
+
+	*c = TxConfig(raw)
+	return nil
+}
+
+func (q Query) txOptions() repo.TxOptions {
+	if q.Tx == nil {
+		return repo.TxOptions{
+			Retry:      repo.TxRetryRestart,
+			MaxRetries: defaultTxMaxRetries,
+		}
+	}
+
+	return repo.TxOptions{
+		Isolation:  sql.IsolationLevel(q.Tx.Isolation),
+		Retry:      q.Tx.Retry,
+		MaxRetries: q.Tx.MaxRetries,
+	}
+}
+
+// dependenciesMet returns true if the VU has the data required to
+// generate all of the query's args. For "tx" queries, args that refer
+// to a preceding statement in the same transaction are ignored, as
+// their data will only be available once that statement has run.
+func (q Query) dependenciesMet(vu *VU) bool {
+	met := func(args []Arg, earlier map[string]struct{}) bool {
+		return lo.EveryBy(args, func(a Arg) bool {
+			if _, ok := earlier[a.refQuery]; ok {
+				return true
+			}
+			return a.dependencyCheck(vu)
+		})
+	}
+
+	if !met(q.Args, nil) {
+		return false
+	}
+
+	earlier := map[string]struct{}{}
+	for _, stmt := range q.Statements {
+		if !met(stmt.Args, earlier) {
+			return false
+		}
+		earlier[stmt.Name] = struct{}{}
+	}
+
+	return true
+}
+
+// Isolation is the isolation level of a transaction.
+type Isolation sql.IsolationLevel
+
+var (
+	isolationLevels = map[string]sql.IsolationLevel{
+		"default":          sql.LevelDefault,
+		"read_uncommitted": sql.LevelReadUncommitted,
+		"read_committed":   sql.LevelReadCommitted,
+		"write_committed":  sql.LevelWriteCommitted,
+		"repeatable_read":  sql.LevelRepeatableRead,
+		"snapshot":         sql.LevelSnapshot,
+		"serializable":     sql.LevelSerializable,
+		"linearizable":     sql.LevelLinearizable,
+	}
+)
+
+func (i *Isolation) UnmarshalYAML(node *yaml.Node) error {
+	level, ok := isolationLevels[strings.ToLower(node.Value)]
+	if !ok {
+		return fmt.Errorf("invalid isolation level: %q", node.Value)
+	}
+
+	*i = Isolation(level)
+	return nil
 }
 
 type Rate struct {
@@ -102,6 +260,43 @@ type Workflow struct {
 	RunAfter     time.Duration   `yaml:"run_after"`
 	RunFor       time.Duration   `yaml:"run_for"`
 	RampFor      time.Duration   `yaml:"ramp_for"`
+	Stages       []Stage         `yaml:"stages"`
+	Mode         WorkflowMode    `yaml:"mode"`
+
+	// Pacing is the minimum time between the start of each iteration
+	// of a sequence workflow (or session of a markov workflow).
+	Pacing time.Duration `yaml:"pacing"`
+
+	// OnEnd determines what happens when a markov workflow's session
+	// ends.
+	OnEnd SessionEnd `yaml:"on_end"`
+}
+
+// Stage moves a workflow's VU count linearly from the previous stage's
+// VU count (or zero) to the given number of VUs over the given duration.
+type Stage struct {
+	Duration time.Duration `yaml:"duration"`
+	Vus      int           `yaml:"vus"`
+}
+
+func (s *Stage) UnmarshalYAML(node *yaml.Node) error {
+	type rawStage Stage
+
+	var raw rawStage
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	if raw.Duration < 0 {
+		return fmt.Errorf("invalid stage duration: %s (should be zero or more)", raw.Duration)
+	}
+
+	if raw.Vus < 0 {
+		return fmt.Errorf("invalid stage vus: %d (should be zero or more)", raw.Vus)
+	}
+
+	*s = Stage(raw)
+	return nil
 }
 
 type Arg struct {
@@ -109,6 +304,13 @@ type Arg struct {
 
 	generator       genFunc
 	dependencyCheck dependencyFunc
+
+	// refQuery is the name of the query a "ref" arg sources its data from.
+	refQuery string
+
+	// name is the name of the arg, for queries whose args are bound by
+	// name.
+	name string
 }
 
 func (a *Arg) UnmarshalYAML(unmarshal func(any) error) error {
@@ -117,10 +319,15 @@ func (a *Arg) UnmarshalYAML(unmarshal func(any) error) error {
 		return err
 	}
 
+	return a.parse(raw)
+}
+
+func (a *Arg) parse(raw map[string]any) error {
 	argType, err := parseField[string](raw, "type")
 	if err != nil {
 		return fmt.Errorf("parsing type: %w", err)
 	}
+	a.Type = argType
 
 	switch argType {
 	case "gen":
@@ -132,6 +339,7 @@ func (a *Arg) UnmarshalYAML(unmarshal func(any) error) error {
 		if a.generator, a.dependencyCheck, err = parseArgTypeRef(raw); err != nil {
 			return fmt.Errorf("parsing ref arg type: %w", err)
 		}
+		a.refQuery, _ = parseField[string](raw, "query")
 
 	case "set":
 		if a.generator, a.dependencyCheck, err = parseArgTypeSet(raw); err != nil {
@@ -158,6 +366,21 @@ func (a *Arg) UnmarshalYAML(unmarshal func(any) error) error {
 			return fmt.Errorf("parsing expr arg type: %w", err)
 		}
 
+	case "seq":
+		if a.generator, a.dependencyCheck, err = parseArgTypeSeq(raw); err != nil {
+			return fmt.Errorf("parsing seq arg type: %w", err)
+		}
+
+	case "file":
+		if a.generator, a.dependencyCheck, err = parseArgTypeFile(raw); err != nil {
+			return fmt.Errorf("parsing file arg type: %w", err)
+		}
+
+	case "array":
+		if a.generator, a.dependencyCheck, a.refQuery, err = parseArgTypeArray(raw); err != nil {
+			return fmt.Errorf("parsing array arg type: %w", err)
+		}
+
 	default:
 		if a.generator, a.dependencyCheck, err = parseArgTypeScalar(argType, raw); err != nil {
 			return fmt.Errorf("parsing scalar arg type: %w", err)
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Drivers that dialects can be provided for.
+var dialectDrivers = []string{"pgx", "mysql", "oracle", "spanner"}
+
+// Dialect overrides a query's statement, and optionally its args, when
+// a given driver is in use.
+type Dialect struct {
+	Query string `yaml:"query"`
+	Args  Args   `yaml:"args"`
+}
+
+// ApplyDialects replaces the statement (and args, if provided) of every
+// activity and tx statement with its dialect for the given driver. It
+// returns the names of those that provide dialects but not one for the
+// driver, which fall back to their default statement.
+func (d *Drk) ApplyDialects(driver string) ([]string, error) {
+	var missing []string
+
+	apply := func(name string, q *Query) error {
+		if len(q.Dialects) == 0 {
+			return nil
+		}
+
+		for key := range q.Dialects {
+			if !lo.Contains(dialectDrivers, key) {
+				return fmt.Errorf("invalid dialect for %q: %q (should be one of: %s)", name, key, strings.Join(dialectDrivers, ", "))
+			}
+		}
+
+		dialect, ok := q.Dialects[driver]
+		if !ok {
+			missing = append(missing, name)
+			return nil
+		}
+
+		if dialect.Query != "" {
+			q.Query = dialect.Query
+		}
+		if dialect.Args != nil {
+			q.Args = dialect.Args
+		}
+
+		return nil
+	}
+
+	for name, q := range d.Activities {
+		if err := apply(name, &q); err != nil {
+			return nil, err
+		}
+
+		for i := range q.Statements {
+			stmt := &q.Statements[i]
+			if err := apply(name+"."+stmt.Name, &stmt.Query); err != nil {
+				return nil, err
+			}
+		}
+
+		d.Activities[name] = q
+	}
+
+	sort.Strings(missing)
+	return missing, nil
+}
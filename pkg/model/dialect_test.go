@@ -0,0 +1,106 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyDialects(t *testing.T) {
+	config := `
+activities:
+  create_shopper:
+    type: query
+    args:
+      - type: gen
+        value: email
+    query: INSERT INTO shopper (email) VALUES ($1) RETURNING id
+    dialects:
+      mysql:
+        query: INSERT INTO shopper (email) VALUES (?)
+      oracle:
+        query: INSERT INTO shopper (email, region) VALUES (:1, :2)
+        args:
+          - type: gen
+            value: email
+          - type: const
+            value: eu
+
+  fetch_shopper:
+    type: query
+    query: SELECT * FROM shopper LIMIT 1
+
+  checkout:
+    type: tx
+    statements:
+      - name: total
+        type: query
+        query: SELECT random()
+        dialects:
+          mysql:
+            query: SELECT RAND()`
+
+	cases := []struct {
+		name       string
+		driver     string
+		expQueries map[string]string
+		expArgs    int
+		expMissing []string
+	}{
+		{
+			name:   "default",
+			driver: "pgx",
+			expQueries: map[string]string{
+				"create_shopper": "INSERT INTO shopper (email) VALUES ($1) RETURNING id",
+				"checkout.total": "SELECT random()",
+			},
+			expArgs:    1,
+			expMissing: []string{"checkout.total", "create_shopper"},
+		},
+		{
+			name:   "query override",
+			driver: "mysql",
+			expQueries: map[string]string{
+				"create_shopper": "INSERT INTO shopper (email) VALUES (?)",
+				"checkout.total": "SELECT RAND()",
+			},
+			expArgs: 1,
+		},
+		{
+			name:   "query and args override",
+			driver: "oracle",
+			expQueries: map[string]string{
+				"create_shopper": "INSERT INTO shopper (email, region) VALUES (:1, :2)",
+				"checkout.total": "SELECT random()",
+			},
+			expArgs:    2,
+			expMissing: []string{"checkout.total"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfg Drk
+			assert.NoError(t, yaml.Unmarshal([]byte(config), &cfg))
+
+			missing, err := cfg.ApplyDialects(c.driver)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expMissing, missing)
+
+			assert.Equal(t, c.expQueries["create_shopper"], cfg.Activities["create_shopper"].Query)
+			assert.Len(t, cfg.Activities["create_shopper"].Args, c.expArgs)
+			assert.Equal(t, c.expQueries["checkout.total"], cfg.Activities["checkout"].Statements[0].Query.Query)
+			assert.Equal(t, "SELECT * FROM shopper LIMIT 1", cfg.Activities["fetch_shopper"].Query)
+		})
+	}
+}
+
+func TestApplyDialectsInvalidDriver(t *testing.T) {
+	cfg := Drk{Activities: map[string]Query{
+		"a": {Query: "SELECT 1", Dialects: map[string]Dialect{"postgres": {Query: "SELECT 2"}}},
+	}}
+
+	_, err := cfg.ApplyDialects("pgx")
+	assert.EqualError(t, err, "invalid dialect for \"a\": \"postgres\" (should be one of: pgx, mysql, oracle, spanner)")
+}
@@ -0,0 +1,307 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// DistributionType determines how values are drawn from a range.
+type DistributionType string
+
+const (
+	// DistributionUniform draws every value in a range with equal
+	// likelihood.
+	DistributionUniform DistributionType = "uniform"
+
+	// DistributionZipf draws values with a likelihood inversely
+	// proportional to their rank (the start of a range being the most
+	// likely), skewed by the s parameter.
+	DistributionZipf DistributionType = "zipf"
+
+	// DistributionNormal draws values around a mean.
+	DistributionNormal DistributionType = "normal"
+
+	// DistributionExponential draws values with a likelihood that
+	// decays exponentially from the start of a range.
+	DistributionExponential DistributionType = "exponential"
+
+	// DistributionHotspot draws values from a hot fraction at the start
+	// of a range with a given probability and from the rest of the range
+	// otherwise.
+	DistributionHotspot DistributionType = "hotspot"
+)
+
+const (
+	defaultZipfS           = 1.1
+	defaultNormalMean      = 0.5
+	defaultNormalStdDev    = 0.15
+	defaultExponentialMean = 0.1
+	defaultHotFraction     = 0.2
+	defaultHotProbability  = 0.8
+
+	// The number of buckets continuous ranges are divided into for
+	// distributions that draw discrete values.
+	distributionResolution = 1 << 20
+
+	// The number of times to redraw values that fall outside of a range
+	// before clamping them.
+	distributionRedraws = 10
+)
+
+// Distribution determines how range generators and ref args choose
+// values. Mean, StdDev, and HotFraction are fractions of a range, so
+// that they apply equally to ranges of numbers, timestamps, and rows.
+// A nil Distribution is uniform.
+type Distribution struct {
+	Type           DistributionType
+	S              float64
+	Mean           float64
+	StdDev         float64
+	HotFraction    float64
+	HotProbability float64
+}
+
+// parseDistribution parses an optional distribution, given either as a
+// type name or as a mapping of type and parameters.
+func parseDistribution(raw map[string]any) (*Distribution, error) {
+	value, ok := raw["distribution"]
+	if !ok {
+		return nil, nil
+	}
+
+	var params map[string]any
+	switch v := value.(type) {
+	case string:
+		params = map[string]any{"type": v}
+	case map[string]any:
+		params = v
+	default:
+		return nil, fmt.Errorf("field type mismatch (got: %T exp: string or map)", value)
+	}
+
+	distType, err := parseField[string](params, "type")
+	if err != nil {
+		return nil, fmt.Errorf("parsing type: %w", err)
+	}
+
+	d := Distribution{Type: DistributionType(distType)}
+
+	fields := []struct {
+		name  string
+		value *float64
+		def   float64
+	}{
+		{name: "s", value: &d.S, def: defaultZipfS},
+		{name: "mean", value: &d.Mean, def: defaultNormalMean},
+		{name: "stddev", value: &d.StdDev, def: defaultNormalStdDev},
+		{name: "hot_fraction", value: &d.HotFraction, def: defaultHotFraction},
+		{name: "hot_probability", value: &d.HotProbability, def: defaultHotProbability},
+	}
+
+	if d.Type == DistributionExponential {
+		fields[1].def = defaultExponentialMean
+	}
+
+	for _, f := range fields {
+		if *f.value, err = parseNumber(params, f.name); err != nil {
+			if _, ok := err.(FieldMissingErr); !ok {
+				return nil, fmt.Errorf("parsing %s: %w", f.name, err)
+			}
+			*f.value = f.def
+		}
+	}
+
+	if err = d.validate(); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (d *Distribution) validate() error {
+	switch d.Type {
+	case DistributionUniform:
+		return nil
+
+	case DistributionZipf:
+		if d.S <= 1 {
+			return fmt.Errorf("invalid s: %v (should be greater than 1)", d.S)
+		}
+
+	case DistributionNormal:
+		if d.Mean < 0 || d.Mean > 1 {
+			return fmt.Errorf("invalid mean: %v (should be between 0 and 1)", d.Mean)
+		}
+		if d.StdDev <= 0 {
+			return fmt.Errorf("invalid stddev: %v (should be greater than 0)", d.StdDev)
+		}
+
+	case DistributionExponential:
+		if d.Mean <= 0 {
+			return fmt.Errorf("invalid mean: %v (should be greater than 0)", d.Mean)
+		}
+
+	case DistributionHotspot:
+		if d.HotFraction <= 0 || d.HotFraction >= 1 {
+			return fmt.Errorf("invalid hot_fraction: %v (should be between 0 and 1)", d.HotFraction)
+		}
+		if d.HotProbability < 0 || d.HotProbability > 1 {
+			return fmt.Errorf("invalid hot_probability: %v (should be between 0 and 1)", d.HotProbability)
+		}
+
+	default:
+		return fmt.Errorf("invalid distribution: %q (should be one of: %s, %s, %s, %s, %s)",
+			d.Type, DistributionUniform, DistributionZipf, DistributionNormal, DistributionExponential, DistributionHotspot)
+	}
+
+	return nil
+}
+
+// sample returns an index between 0 and n (exclusive).
+func (d *Distribution) sample(n int) int {
+	if n <= 1 {
+		return 0
+	}
+
+	if d == nil {
+		return rand.IntN(n)
+	}
+
+	switch d.Type {
+	case DistributionZipf:
+		return int(rand.NewZipf(rand.New(globalSource{}), d.S, 1, uint64(n-1)).Uint64())
+
+	case DistributionNormal:
+		return scale(redraw(func() float64 {
+			return d.Mean + rand.NormFloat64()*d.StdDev
+		}), n)
+
+	case DistributionExponential:
+		return scale(redraw(func() float64 {
+			return rand.ExpFloat64() * d.Mean
+		}), n)
+
+	case DistributionHotspot:
+		hot := max(1, int(math.Ceil(float64(n)*d.HotFraction)))
+		if hot >= n {
+			return rand.IntN(n)
+		}
+
+		if rand.Float64() < d.HotProbability {
+			return rand.IntN(hot)
+		}
+		return hot + rand.IntN(n-hot)
+
+	default:
+		return rand.IntN(n)
+	}
+}
+
+// fraction returns a value between 0 and 1 (exclusive).
+func (d *Distribution) fraction() float64 {
+	if d == nil || d.Type == DistributionUniform {
+		return rand.Float64()
+	}
+
+	bucket := d.sample(distributionResolution)
+	return (float64(bucket) + rand.Float64()) / distributionResolution
+}
+
+// Int returns a value between min and max (exclusive).
+func (d *Distribution) Int(min, max int) int {
+	if min == max {
+		return min
+	}
+
+	if min > max {
+		min, max = max, min
+	}
+
+	return min + d.sample(max-min)
+}
+
+// Float returns a value between min and max (exclusive).
+func (d *Distribution) Float(min, max float64) float64 {
+	if min == max {
+		return min
+	}
+
+	if min > max {
+		min, max = max, min
+	}
+
+	return min + d.fraction()*(max-min)
+}
+
+// Timestamp returns a value between min and max (exclusive), to the
+// nearest second.
+func (d *Distribution) Timestamp(min, max time.Time) time.Time {
+	if min.Equal(max) {
+		return min
+	}
+
+	if min.After(max) {
+		min, max = max, min
+	}
+
+	delta := max.Unix() - min.Unix()
+	return time.Unix(min.Unix()+int64(d.sample(int(delta))), 0)
+}
+
+// Interval returns a value between min and max (exclusive).
+func (d *Distribution) Interval(min, max time.Duration) time.Duration {
+	if min == max {
+		return min
+	}
+
+	if min > max {
+		min, max = max, min
+	}
+
+	return min + time.Duration(d.sample(int(max-min)))
+}
+
+// redraw draws values until one falls between 0 and 1 (exclusive),
+// clamping the last if none do.
+func redraw(draw func() float64) float64 {
+	var f float64
+	for range distributionRedraws {
+		if f = draw(); f >= 0 && f < 1 {
+			return f
+		}
+	}
+
+	return math.Min(math.Max(f, 0), math.Nextafter(1, 0))
+}
+
+func scale(f float64, n int) int {
+	return min(int(f*float64(n)), n-1)
+}
+
+// globalSource is a concurrency-safe rand.Source backed by the global
+// random number generator.
+type globalSource struct{}
+
+func (globalSource) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+// parseNumber parses a field that may have been decoded as either an
+// int or a float.
+func parseNumber(m map[string]any, key string) (float64, error) {
+	valueRaw, ok := m[key]
+	if !ok {
+		return 0, FieldMissingErr{Name: key}
+	}
+
+	switch v := valueRaw.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("field type mismatch (got: %T exp: number)", valueRaw)
+	}
+}
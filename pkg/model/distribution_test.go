@@ -0,0 +1,181 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDistribution(t *testing.T) {
+	cases := []struct {
+		name   string
+		raw    map[string]any
+		exp    *Distribution
+		expErr error
+	}{
+		{
+			name: "missing",
+			raw:  map[string]any{},
+		},
+		{
+			name: "type name",
+			raw:  map[string]any{"distribution": "zipf"},
+			exp: &Distribution{
+				Type:           DistributionZipf,
+				S:              defaultZipfS,
+				Mean:           defaultNormalMean,
+				StdDev:         defaultNormalStdDev,
+				HotFraction:    defaultHotFraction,
+				HotProbability: defaultHotProbability,
+			},
+		},
+		{
+			name: "parameters",
+			raw: map[string]any{"distribution": map[string]any{
+				"type":            "hotspot",
+				"hot_fraction":    0.01,
+				"hot_probability": 0.99,
+			}},
+			exp: &Distribution{
+				Type:           DistributionHotspot,
+				S:              defaultZipfS,
+				Mean:           defaultNormalMean,
+				StdDev:         defaultNormalStdDev,
+				HotFraction:    0.01,
+				HotProbability: 0.99,
+			},
+		},
+		{
+			name: "exponential default mean",
+			raw:  map[string]any{"distribution": "exponential"},
+			exp: &Distribution{
+				Type:           DistributionExponential,
+				S:              defaultZipfS,
+				Mean:           defaultExponentialMean,
+				StdDev:         defaultNormalStdDev,
+				HotFraction:    defaultHotFraction,
+				HotProbability: defaultHotProbability,
+			},
+		},
+		{
+			name:   "invalid type",
+			raw:    map[string]any{"distribution": "pareto"},
+			expErr: fmt.Errorf("invalid distribution: \"pareto\" (should be one of: uniform, zipf, normal, exponential, hotspot)"),
+		},
+		{
+			name:   "invalid zipf s",
+			raw:    map[string]any{"distribution": map[string]any{"type": "zipf", "s": 1}},
+			expErr: fmt.Errorf("invalid s: 1 (should be greater than 1)"),
+		},
+		{
+			name:   "invalid normal mean",
+			raw:    map[string]any{"distribution": map[string]any{"type": "normal", "mean": 2}},
+			expErr: fmt.Errorf("invalid mean: 2 (should be between 0 and 1)"),
+		},
+		{
+			name:   "invalid parameter type",
+			raw:    map[string]any{"distribution": map[string]any{"type": "normal", "mean": "high"}},
+			expErr: fmt.Errorf("parsing mean: %w", fmt.Errorf("field type mismatch (got: string exp: number)")),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := parseDistribution(c.raw)
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestDistributionSample(t *testing.T) {
+	const n, samples = 100, 10000
+
+	cases := []struct {
+		name    string
+		dist    *Distribution
+		expFunc func(t *testing.T, counts []int)
+	}{
+		{
+			name: "uniform",
+			dist: nil,
+			expFunc: func(t *testing.T, counts []int) {
+				test.NumberBetween(t, sum(counts[:50]), samples*4/10, samples*6/10)
+			},
+		},
+		{
+			name: "zipf",
+			dist: &Distribution{Type: DistributionZipf, S: 2},
+			expFunc: func(t *testing.T, counts []int) {
+				assert.Greater(t, counts[0], samples/2)
+				assert.Greater(t, counts[0], counts[1])
+			},
+		},
+		{
+			name: "normal",
+			dist: &Distribution{Type: DistributionNormal, Mean: 0.5, StdDev: 0.05},
+			expFunc: func(t *testing.T, counts []int) {
+				test.NumberBetween(t, sum(counts[35:65]), samples*9/10, samples)
+			},
+		},
+		{
+			name: "exponential",
+			dist: &Distribution{Type: DistributionExponential, Mean: 0.1},
+			expFunc: func(t *testing.T, counts []int) {
+				test.NumberBetween(t, sum(counts[:10]), samples*5/10, samples*75/100)
+			},
+		},
+		{
+			name: "hotspot",
+			dist: &Distribution{Type: DistributionHotspot, HotFraction: 0.1, HotProbability: 0.9},
+			expFunc: func(t *testing.T, counts []int) {
+				test.NumberBetween(t, sum(counts[:10]), samples*85/100, samples*95/100)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			counts := make([]int, n)
+			for range samples {
+				i := c.dist.sample(n)
+				if !assert.True(t, i >= 0 && i < n, "sample out of range: %d", i) {
+					return
+				}
+				counts[i]++
+			}
+
+			c.expFunc(t, counts)
+		})
+	}
+}
+
+func TestDistributionRanges(t *testing.T) {
+	dist := &Distribution{Type: DistributionZipf, S: 1.5}
+
+	minTS := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxTS := minTS.Add(time.Hour)
+
+	for range 1000 {
+		test.NumberBetween(t, dist.Int(10, 20), 10, 19)
+		test.NumberBetween(t, dist.Float(10, 20), 10, 20)
+		test.NumberBetween(t, dist.Interval(time.Second, time.Minute), time.Second, time.Minute)
+		test.TimestampBetween(t, dist.Timestamp(minTS, maxTS), minTS, maxTS.Add(-time.Second))
+	}
+}
+
+func sum(values []int) int {
+	var total int
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -6,6 +6,47 @@ import "time"
 type Event struct {
 	Workflow string
 	Name     string
-	Duration time.Duration
-	Err      error
+
+	// ServiceTime is the time taken by the database to perform the
+	// operation.
+	ServiceTime time.Duration
+
+	// ResponseTime is the time between the operation's intended start
+	// time (as per its schedule) and its completion. Unlike ServiceTime,
+	// it includes any time the operation spent waiting behind previous,
+	// slower operations, so isn't subject to coordinated omission.
+	ResponseTime time.Duration
+
+	Err error
+
+	// Expected is set if Err matched the activity's expected errors, in
+	// which case it isn't counted as an error.
+	Expected bool
+
+	// AssertionFailed is set if the operation succeeded but the rows it
+	// returned failed its assertion, which is described by Err.
+	AssertionFailed bool
+
+	// Attempts is the number of times the operation was run, which is
+	// greater than one if it was retried.
+	Attempts int
+
+	// Check is set for events that record the result of a check, rather
+	// than an operation being performed. Err is set if the check failed
+	// to run.
+	Check *CheckResult
+
+	// Transition is set for events that record a step being taken in a
+	// markov workflow, rather than an operation being performed.
+	Transition *Transition
+}
+
+// Transition is a step taken between two states of a markov workflow.
+type Transition struct {
+	From string
+	To   string
+}
+
+func (t Transition) String() string {
+	return t.From + " -> " + t.To
 }
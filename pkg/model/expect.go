@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"gopkg.in/yaml.v3"
+)
+
+// ExpectedErrors match the errors an activity is expected to encounter,
+// which are counted separately from its errors.
+type ExpectedErrors []expectedError
+
+// expectedError matches errors by driver code (e.g. "23505"), category
+// (e.g. "constraint"), or a regular expression over the error message.
+type expectedError struct {
+	value   string
+	pattern *regexp.Regexp
+}
+
+func (e *ExpectedErrors) UnmarshalYAML(node *yaml.Node) error {
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+
+	expected := make(ExpectedErrors, 0, len(values))
+	for _, value := range values {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("parsing expected error %q: %w", value, err)
+		}
+
+		expected = append(expected, expectedError{value: value, pattern: pattern})
+	}
+
+	*e = expected
+	return nil
+}
+
+// match returns true if an error is expected.
+func (e ExpectedErrors) match(err error) bool {
+	if err == nil || len(e) == 0 {
+		return false
+	}
+
+	class := repo.Classify(err)
+	msg := err.Error()
+
+	for _, expected := range e {
+		switch {
+		case class.Code != "" && strings.EqualFold(expected.value, class.Code):
+			return true
+		case expected.value == string(class.Category):
+			return true
+		case expected.pattern.MatchString(msg):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpectedErrorsMatch(t *testing.T) {
+	var expected ExpectedErrors
+	assert.NoError(t, yaml.Unmarshal([]byte(`["23505", "retryable", "could not obtain lock"]`), &expected))
+
+	cases := []struct {
+		name string
+		err  error
+		exp  bool
+	}{
+		{name: "nil", err: nil, exp: false},
+		{name: "code", err: fmt.Errorf("running query: %w", &pgconn.PgError{Code: "23505"}), exp: true},
+		{name: "category", err: &pgconn.PgError{Code: "40P01"}, exp: true},
+		{name: "pattern", err: &pgconn.PgError{Code: "55P03", Message: "could not obtain lock on row"}, exp: true},
+		{name: "no match", err: &pgconn.PgError{Code: "23502", Message: "null value in column"}, exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, expected.match(c.err))
+		})
+	}
+}
+
+func TestExpectedErrorsUnmarshalYAMLInvalid(t *testing.T) {
+	var expected ExpectedErrors
+	assert.ErrorContains(t, yaml.Unmarshal([]byte(`["dup(licate"]`), &expected), "parsing expected error \"dup(licate\":")
+}
+
+func TestExecActivityExpectedErrors(t *testing.T) {
+	duplicate := &pgconn.PgError{Code: "23505"}
+
+	queryer := mockQueryer{
+		exec: func(query string, args ...any) (time.Duration, error) {
+			return 0, duplicate
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, EnvironmentVariables{Retries: 3}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	var expected ExpectedErrors
+	assert.NoError(t, yaml.Unmarshal([]byte(`["23505"]`), &expected))
+
+	query := Query{Type: "exec", Query: "INSERT INTO t (id) VALUES (1)", ExpectErrors: expected}
+	r.execActivity(context.Background(), NewVU(r), "w", "insert", query, time.Now())
+
+	event := <-r.events
+	assert.True(t, event.Expected)
+	assert.Equal(t, duplicate, event.Err)
+	assert.Equal(t, 1, event.Attempts)
+
+	query.ExpectErrors = nil
+	r.execActivity(context.Background(), NewVU(r), "w", "insert", query, time.Now())
+
+	event = <-r.events
+	assert.False(t, event.Expected)
+	assert.Equal(t, 3, event.Attempts)
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/random"
+)
+
+// exprEnv returns the environment expr args are evaluated against,
+// exposing the state of the VU generating a query call's args. A nil
+// VU provides an environment for compiling expressions.
+func exprEnv(vu *VU) map[string]any {
+	env := map[string]any{
+		"env": func(name string) string {
+			return os.Getenv(name)
+		},
+		"gen": func(name string) (any, error) {
+			g, ok := random.Replacements[name]
+			if !ok {
+				return nil, fmt.Errorf("missing generator: %q", name)
+			}
+			return g(), nil
+		},
+		"data":      func(query string) []map[string]any { return nil },
+		"arg":       func(key any) (any, error) { return nil, nil },
+		"global":    func(name string) (any, error) { return nil, nil },
+		"vu":        0,
+		"workflow":  "",
+		"iteration": 0,
+		"elapsed":   time.Duration(0),
+	}
+
+	if vu == nil {
+		return env
+	}
+
+	env["data"] = func(query string) []map[string]any {
+		vu.dataMu.RLock()
+		defer vu.dataMu.RUnlock()
+
+		return vu.data[query]
+	}
+
+	env["arg"] = vu.arg
+
+	env["global"] = func(name string) (any, error) {
+		if vu.r == nil {
+			return nil, fmt.Errorf("missing global arg: %q", name)
+		}
+
+		value, ok := vu.r.globalArgs.get(name)
+		if !ok {
+			return nil, fmt.Errorf("missing global arg: %q", name)
+		}
+		return value, nil
+	}
+
+	env["vu"] = vu.id
+	env["workflow"] = vu.workflow
+	env["iteration"] = vu.iteration
+
+	if vu.r != nil && !vu.r.started.IsZero() {
+		env["elapsed"] = time.Since(vu.r.started)
+	}
+
+	return env
+}
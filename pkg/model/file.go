@@ -0,0 +1,313 @@
+package model
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// FileFormat is the format of a file arg's data.
+type FileFormat string
+
+const (
+	// FileFormatCSV reads rows from a CSV file with a header row.
+	FileFormatCSV FileFormat = "csv"
+
+	// FileFormatJSONL reads rows from a file of JSON objects, one per
+	// line.
+	FileFormatJSONL FileFormat = "jsonl"
+
+	// FileFormatLines reads values from a file, one per line.
+	FileFormatLines FileFormat = "lines"
+)
+
+// FilePick determines how a file arg selects rows.
+type FilePick string
+
+const (
+	// FilePickRandom selects a random row each time.
+	FilePickRandom FilePick = "random"
+
+	// FilePickSequential selects rows in order, using a cursor shared
+	// between VUs.
+	FilePickSequential FilePick = "sequential"
+
+	// FilePickUnique selects rows in a random order, using each row
+	// once.
+	FilePickUnique FilePick = "unique"
+)
+
+// FileEnd determines what a sequential file arg does once every row
+// has been used.
+type FileEnd string
+
+const (
+	// FileEndWrap starts again from the first row.
+	FileEndWrap FileEnd = "wrap"
+
+	// FileEndStop stops providing values.
+	FileEndStop FileEnd = "stop"
+)
+
+// ErrSourceExhausted is returned by args whose data source has no more
+// rows to provide.
+var ErrSourceExhausted = errors.New("data source exhausted")
+
+// fileSource selects rows from a file loaded at startup.
+type fileSource struct {
+	path  string
+	rows  []map[string]any
+	pick  FilePick
+	onEnd FileEnd
+
+	cursor atomic.Int64
+}
+
+func parseArgTypeFile(raw map[string]any) (genFunc, dependencyFunc, error) {
+	path, err := parseField[string](raw, "path")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing path: %w", err)
+	}
+
+	format, err := parseField[string](raw, "format")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing format: %w", err)
+		}
+		format = string(defaultFileFormat(path))
+	}
+
+	column, err := parseField[string](raw, "column")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok || FileFormat(format) != FileFormatLines {
+			return nil, nil, fmt.Errorf("parsing column: %w", err)
+		}
+	}
+
+	pick, err := parseField[string](raw, "pick")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing pick: %w", err)
+		}
+		pick = string(FilePickRandom)
+	}
+
+	switch FilePick(pick) {
+	case FilePickRandom, FilePickSequential, FilePickUnique:
+	default:
+		return nil, nil, fmt.Errorf("invalid pick: %q (should be one of: %s, %s, %s)", pick, FilePickRandom, FilePickSequential, FilePickUnique)
+	}
+
+	onEnd, err := parseField[string](raw, "on_end")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing on_end: %w", err)
+		}
+		onEnd = string(FileEndWrap)
+	}
+
+	switch FileEnd(onEnd) {
+	case FileEndWrap, FileEndStop:
+	default:
+		return nil, nil, fmt.Errorf("invalid on_end: %q (should be one of: %s, %s)", onEnd, FileEndWrap, FileEndStop)
+	}
+
+	bind, err := parseField[string](raw, "bind")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing bind: %w", err)
+		}
+	}
+
+	rows, err := loadFile(path, FileFormat(format))
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading file: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("no rows found in file: %q", path)
+	}
+
+	if _, ok := rows[0][column]; !ok {
+		return nil, nil, fmt.Errorf("missing column: %q", column)
+	}
+
+	source := &fileSource{
+		path:  path,
+		rows:  rows,
+		pick:  FilePick(pick),
+		onEnd: FileEnd(onEnd),
+	}
+
+	if source.pick == FilePickUnique {
+		rand.Shuffle(len(rows), func(i, j int) {
+			rows[i], rows[j] = rows[j], rows[i]
+		})
+	}
+
+	genFunc := func(vu *VU) (any, error) {
+		row, err := vu.bindRow(bind, "file:"+path, source.next)
+		if err != nil {
+			return nil, err
+		}
+
+		cell, ok := row[column]
+		if !ok {
+			return nil, fmt.Errorf("missing column: %q", column)
+		}
+
+		return cell, nil
+	}
+
+	return genFunc, dependencyFuncNoop, nil
+}
+
+// next returns the next row from the file.
+func (s *fileSource) next() (map[string]any, error) {
+	if s.pick == FilePickRandom {
+		return s.rows[rand.IntN(len(s.rows))], nil
+	}
+
+	i := s.cursor.Add(1) - 1
+	if i >= int64(len(s.rows)) {
+		if s.pick == FilePickUnique || s.onEnd == FileEndStop {
+			return nil, fmt.Errorf("reading %q: %w", s.path, ErrSourceExhausted)
+		}
+		i %= int64(len(s.rows))
+	}
+
+	return s.rows[i], nil
+}
+
+// defaultFileFormat returns the format of a file based on its extension,
+// treating unknown extensions as lines.
+func defaultFileFormat(path string) FileFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FileFormatCSV
+	case ".jsonl", ".ndjson":
+		return FileFormatJSONL
+	default:
+		return FileFormatLines
+	}
+}
+
+func loadFile(path string, format FileFormat) ([]map[string]any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case FileFormatCSV:
+		return readCSV(file)
+	case FileFormatJSONL:
+		return readJSONL(file)
+	case FileFormatLines:
+		return readLines(file)
+	default:
+		return nil, fmt.Errorf("invalid format: %q (should be one of: %s, %s, %s)", format, FileFormatCSV, FileFormatJSONL, FileFormatLines)
+	}
+}
+
+func readCSV(r io.Reader) ([]map[string]any, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]any, 0, len(records)-1)
+
+	for _, record := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readJSONL(r io.Reader) ([]map[string]any, error) {
+	var rows []map[string]any
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+
+		var row map[string]any
+		if err := decoder.Decode(&row); err != nil {
+			return nil, fmt.Errorf("decoding line %d: %w", line, err)
+		}
+
+		for k, v := range row {
+			row[k] = jsonNumber(v)
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading jsonl: %w", err)
+	}
+
+	return rows, nil
+}
+
+// jsonNumber converts JSON numbers into int64s or float64s, which
+// database drivers can bind.
+func jsonNumber(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+
+	f, _ := n.Float64()
+	return f
+}
+
+// readLines reads non-empty lines, keyed by an empty column name.
+func readLines(r io.Reader) ([]map[string]any, error) {
+	var rows []map[string]any
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		rows = append(rows, map[string]any{"": text})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading lines: %w", err)
+	}
+
+	return rows, nil
+}
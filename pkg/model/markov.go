@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// Reserved states in a markov workflow. Every session starts with a
+// transition from markovStart to the workflow's first query and ends
+// with a transition to markovEnd.
+const (
+	markovStart = "start"
+	markovEnd   = "end"
+)
+
+// SessionEnd determines what a VU does once its markov session ends.
+type SessionEnd string
+
+const (
+	// SessionEndRestart starts a new session from the workflow's first
+	// query.
+	SessionEndRestart SessionEnd = "restart"
+
+	// SessionEndStop stops the VU.
+	SessionEndStop SessionEnd = "stop"
+)
+
+func (s *SessionEnd) UnmarshalYAML(node *yaml.Node) error {
+	switch end := SessionEnd(node.Value); end {
+	case SessionEndRestart, SessionEndStop:
+		*s = end
+		return nil
+
+	default:
+		return fmt.Errorf("invalid on_end: %q (should be one of: %s, %s)", node.Value, SessionEndRestart, SessionEndStop)
+	}
+}
+
+// Transitions are the weighted next steps of a markov workflow query,
+// keyed by query name (or "end" to end the session).
+type Transitions struct {
+	Weights map[string]int
+
+	items weightedItems
+}
+
+func (t *Transitions) UnmarshalYAML(node *yaml.Node) error {
+	var weights map[string]int
+	if err := node.Decode(&weights); err != nil {
+		return err
+	}
+
+	// Sort for a deterministic order, as maps are unordered.
+	names := lo.Keys(weights)
+	sort.Strings(names)
+
+	values := make([]any, len(names))
+	weightValues := make([]int, len(names))
+
+	for i, name := range names {
+		if weights[name] <= 0 {
+			return fmt.Errorf("invalid weight for transition to %q: %d (should be greater than 0)", name, weights[name])
+		}
+
+		values[i] = name
+		weightValues[i] = weights[name]
+	}
+
+	items, err := buildWeightedItems(values, weightValues)
+	if err != nil {
+		return fmt.Errorf("building weighted items: %w", err)
+	}
+
+	*t = Transitions{
+		Weights: weights,
+		items:   items,
+	}
+
+	return nil
+}
+
+// next returns the name of the next step, ending the session if there
+// are no transitions.
+func (t Transitions) next() string {
+	if len(t.Weights) == 0 {
+		return markovEnd
+	}
+
+	return t.items.choose().(string)
+}
+
+// validateMarkovWorkflows validates the transitions of every markov
+// workflow, so that invalid transitions are caught before anything
+// runs.
+func validateMarkovWorkflows(workflows map[string]Workflow) error {
+	names := lo.Keys(workflows)
+	sort.Strings(names)
+
+	for _, name := range names {
+		workflow := workflows[name]
+		if workflow.Mode != WorkflowModeMarkov {
+			continue
+		}
+
+		if err := validateTransitions(workflow); err != nil {
+			return fmt.Errorf("validating markov workflow %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateTransitions checks that every transition in a markov
+// workflow leads to one of its queries or ends the session.
+func validateTransitions(workflow Workflow) error {
+	steps := lo.SliceToMap(workflow.Queries, func(q WorkflowQuery) (string, struct{}) {
+		return q.Name, struct{}{}
+	})
+
+	for _, q := range workflow.Queries {
+		if q.Name == markovStart || q.Name == markovEnd {
+			return fmt.Errorf("invalid markov step name: %q is reserved", q.Name)
+		}
+
+		for to := range q.Next.Weights {
+			if _, ok := steps[to]; !ok && to != markovEnd {
+				return fmt.Errorf("invalid transition from %q: %q is not a query in the workflow", q.Name, to)
+			}
+		}
+	}
+
+	return nil
+}
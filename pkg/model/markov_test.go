@@ -0,0 +1,179 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTransitionsUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name       string
+		yaml       string
+		expWeights map[string]int
+		expErr     error
+	}{
+		{
+			name:       "valid",
+			yaml:       "next: {add_to_basket: 30, browse_product: 65, end: 5}",
+			expWeights: map[string]int{"add_to_basket": 30, "browse_product": 65, "end": 5},
+		},
+		{
+			name:   "invalid weight",
+			yaml:   "next: {add_to_basket: 0}",
+			expErr: fmt.Errorf("invalid weight for transition to \"add_to_basket\": 0 (should be greater than 0)"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var wq WorkflowQuery
+			err := yaml.Unmarshal([]byte(c.yaml), &wq)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, c.expWeights, wq.Next.Weights)
+			assert.Equal(t, 100, wq.Next.items.totalWeight)
+		})
+	}
+}
+
+func TestTransitionsNext(t *testing.T) {
+	var wq WorkflowQuery
+	assert.NoError(t, yaml.Unmarshal([]byte("next: {a: 1, end: 1}"), &wq))
+
+	counts := map[string]int{}
+	for range 1000 {
+		counts[wq.Next.next()]++
+	}
+
+	assert.Greater(t, counts["a"], 0)
+	assert.Greater(t, counts[markovEnd], 0)
+
+	// Queries without transitions end the session.
+	assert.Equal(t, markovEnd, Transitions{}.next())
+}
+
+func TestValidateTransitions(t *testing.T) {
+	cases := []struct {
+		name     string
+		workflow string
+		expErr   error
+	}{
+		{
+			name: "valid",
+			workflow: `
+queries:
+  - name: a
+    next: {a: 1, b: 1}
+  - name: b
+    next: {end: 1}`,
+		},
+		{
+			name: "unknown query",
+			workflow: `
+queries:
+  - name: a
+    next: {c: 1}`,
+			expErr: fmt.Errorf("invalid transition from \"a\": \"c\" is not a query in the workflow"),
+		},
+		{
+			name: "reserved name",
+			workflow: `
+queries:
+  - name: end`,
+			expErr: fmt.Errorf("invalid markov step name: \"end\" is reserved"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var workflow Workflow
+			assert.NoError(t, yaml.Unmarshal([]byte(c.workflow), &workflow))
+			assert.Equal(t, c.expErr, validateTransitions(workflow))
+		})
+	}
+}
+
+func TestNewRunnerInvalidMarkovWorkflow(t *testing.T) {
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			t.Fatalf("unexpected query: %s", s)
+			return 0, nil
+		},
+	}
+
+	var cfg Drk
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+workflows:
+  browse:
+    vus: 1
+    mode: markov
+    setup_queries:
+      - seed
+    queries:
+      - name: view
+        next: {buy: 1}
+activities:
+  seed:
+    type: exec
+    query: INSERT INTO t DEFAULT VALUES
+  view:
+    type: exec
+    query: SELECT 1`), &cfg))
+
+	_, err := NewRunner(&cfg, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.EqualError(t, err, `validating markov workflow "browse": invalid transition from "view": "buy" is not a query in the workflow`)
+}
+
+func TestRunMarkov(t *testing.T) {
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			return 0, nil
+		},
+	}
+
+	cfg := Drk{
+		Activities: map[string]Query{
+			"browse":   {Type: "exec"},
+			"checkout": {Type: "exec"},
+		},
+	}
+
+	r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	var workflow Workflow
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+mode: markov
+on_end: stop
+queries:
+  - name: browse
+    next: {checkout: 1}
+  - name: checkout`), &workflow))
+
+	vu := NewVU(r)
+	assert.NoError(t, r.runMarkov(context.Background(), vu, "test", workflow, make(chan struct{})))
+	close(r.events)
+
+	var transitions []string
+	var queries []string
+	for e := range r.events {
+		if e.Transition != nil {
+			transitions = append(transitions, e.Transition.String())
+		} else {
+			queries = append(queries, e.Name)
+		}
+	}
+
+	assert.Equal(t, []string{"start -> browse", "browse -> checkout", "checkout -> end"}, transitions)
+	assert.Equal(t, []string{"browse", "checkout"}, queries)
+	assert.Equal(t, 1, vu.iteration)
+}
@@ -1,18 +1,48 @@
 package model
 
 import (
+	"context"
 	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
 )
 
 type mockQueryer struct {
 	query func(query string, args ...any) ([]map[string]any, time.Duration, error)
 	exec  func(query string, args ...any) (time.Duration, error)
+	tx    func(opts repo.TxOptions, fn func(repo.Queryer) error) (time.Duration, error)
+
+	// prepare is optional, statements are prepared without error if
+	// it's not set.
+	prepare func(query string) error
 }
 
-func (m *mockQueryer) Query(query string, args ...any) ([]map[string]any, time.Duration, error) {
+func (m *mockQueryer) Query(_ context.Context, query string, args ...any) ([]map[string]any, time.Duration, error) {
 	return m.query(query, args...)
 }
 
-func (m *mockQueryer) Exec(query string, args ...any) (time.Duration, error) {
+func (m *mockQueryer) Exec(_ context.Context, query string, args ...any) (time.Duration, error) {
 	return m.exec(query, args...)
 }
+
+func (m *mockQueryer) Tx(_ context.Context, opts repo.TxOptions, fn func(repo.Queryer) error) (time.Duration, error) {
+	return m.tx(opts, fn)
+}
+
+func (m *mockQueryer) Prepare(_ context.Context, query string) (*repo.Stmt, error) {
+	if m.prepare != nil {
+		if err := m.prepare(query); err != nil {
+			return nil, err
+		}
+	}
+
+	return &repo.Stmt{Query: query}, nil
+}
+
+func (m *mockQueryer) QueryStmt(_ context.Context, stmt *repo.Stmt, args ...any) ([]map[string]any, time.Duration, error) {
+	return m.query(stmt.Query, args...)
+}
+
+func (m *mockQueryer) ExecStmt(_ context.Context, stmt *repo.Stmt, args ...any) (time.Duration, error) {
+	return m.exec(stmt.Query, args...)
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowMode determines how a VU executes its workflow's queries.
+type WorkflowMode string
+
+const (
+	// WorkflowModeConcurrent executes each of the workflow's queries
+	// independently, at their own rates.
+	WorkflowModeConcurrent WorkflowMode = "concurrent"
+
+	// WorkflowModeSequence executes the workflow's queries as ordered
+	// steps, repeating the sequence until the end of the test.
+	WorkflowModeSequence WorkflowMode = "sequence"
+
+	// WorkflowModeMarkov executes the workflow's queries as steps,
+	// starting with the first and choosing each subsequent step at
+	// random from the weighted transitions of the step before it.
+	WorkflowModeMarkov WorkflowMode = "markov"
+)
+
+func (m *WorkflowMode) UnmarshalYAML(node *yaml.Node) error {
+	switch mode := WorkflowMode(node.Value); mode {
+	case WorkflowModeConcurrent, WorkflowModeSequence, WorkflowModeMarkov:
+		*m = mode
+		return nil
+
+	default:
+		return fmt.Errorf("invalid workflow mode: %q (should be one of: %s, %s, %s)", node.Value, WorkflowModeConcurrent, WorkflowModeSequence, WorkflowModeMarkov)
+	}
+}
+
+// stepped returns true if the workflow's queries are executed as steps
+// by a single loop, rather than independently at their own rates.
+func (m WorkflowMode) stepped() bool {
+	return m == WorkflowModeSequence || m == WorkflowModeMarkov
+}
+
+// ThinkTime is the time a VU waits after executing a step, either
+// fixed (e.g. "2s") or chosen at random from a range (e.g. "{min: 1s,
+// max: 5s}").
+type ThinkTime struct {
+	Min time.Duration `yaml:"min"`
+	Max time.Duration `yaml:"max"`
+}
+
+func (t *ThinkTime) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		d, err := time.ParseDuration(node.Value)
+		if err != nil {
+			return fmt.Errorf("parsing think time: %w", err)
+		}
+
+		*t = ThinkTime{Min: d, Max: d}
+		return nil
+	}
+
+	type rawThinkTime ThinkTime
+
+	var raw rawThinkTime
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	if raw.Min > raw.Max {
+		return fmt.Errorf("invalid think time: min (%s) is greater than max (%s)", raw.Min, raw.Max)
+	}
+
+	*t = ThinkTime(raw)
+	return nil
+}
+
+// next returns the time to wait after a step.
+func (t ThinkTime) next() time.Duration {
+	return Interval(t.Min, t.Max)
+}
+
+func (t ThinkTime) String() string {
+	if t.Min == t.Max {
+		return t.Min.String()
+	}
+
+	return fmt.Sprintf("%s-%s", t.Min, t.Max)
+}
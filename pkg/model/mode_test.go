@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWorkflowModeUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    WorkflowMode
+		expErr error
+	}{
+		{
+			name: "default",
+			yaml: "vus: 1",
+			exp:  "",
+		},
+		{
+			name: "concurrent",
+			yaml: "mode: concurrent",
+			exp:  WorkflowModeConcurrent,
+		},
+		{
+			name: "sequence",
+			yaml: "mode: sequence",
+			exp:  WorkflowModeSequence,
+		},
+		{
+			name: "markov",
+			yaml: "mode: markov",
+			exp:  WorkflowModeMarkov,
+		},
+		{
+			name:   "invalid",
+			yaml:   "mode: invalid",
+			expErr: fmt.Errorf("invalid workflow mode: \"invalid\" (should be one of: concurrent, sequence, markov)"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var w Workflow
+			err := yaml.Unmarshal([]byte(c.yaml), &w)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, c.exp, w.Mode)
+		})
+	}
+}
+
+func TestThinkTimeUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    ThinkTime
+		expErr error
+	}{
+		{
+			name: "fixed",
+			yaml: "think_time: 2s",
+			exp:  ThinkTime{Min: time.Second * 2, Max: time.Second * 2},
+		},
+		{
+			name: "range",
+			yaml: "think_time: {min: 1s, max: 5s}",
+			exp:  ThinkTime{Min: time.Second, Max: time.Second * 5},
+		},
+		{
+			name:   "invalid range",
+			yaml:   "think_time: {min: 5s, max: 1s}",
+			expErr: fmt.Errorf("invalid think time: min (5s) is greater than max (1s)"),
+		},
+		{
+			name:   "invalid duration",
+			yaml:   "think_time: soon",
+			expErr: fmt.Errorf("parsing think time: %w", fmt.Errorf("time: invalid duration %q", "soon")),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var wq WorkflowQuery
+			err := yaml.Unmarshal([]byte(c.yaml), &wq)
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, wq.ThinkTime)
+		})
+	}
+}
+
+func TestThinkTimeNext(t *testing.T) {
+	tt := ThinkTime{Min: time.Second, Max: time.Second * 5}
+
+	for range 100 {
+		test.NumberBetween(t, tt.next(), time.Second, time.Second*5)
+	}
+}
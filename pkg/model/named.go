@@ -0,0 +1,279 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var argNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Args are the args of a query, given either as a list (bound by
+// position) or as a mapping of names to args (bound by name, using
+// :name or {{name}} in the query).
+type Args []Arg
+
+func (a *Args) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		var args []Arg
+		if err := node.Decode(&args); err != nil {
+			return err
+		}
+
+		*a = args
+		return nil
+	}
+
+	// Decode mappings pair by pair, to preserve the order of the args.
+	args := make([]Arg, 0, len(node.Content)/2)
+	for i := 0; i < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		if !argNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid arg name: %q (should contain only letters, numbers, and underscores)", name)
+		}
+
+		var arg Arg
+		if err := node.Content[i+1].Decode(&arg); err != nil {
+			return fmt.Errorf("parsing arg %q: %w", name, err)
+		}
+
+		arg.name = name
+		args = append(args, arg)
+	}
+
+	*a = args
+	return nil
+}
+
+// GlobalArgs are the top-level args of a config, given as a mapping of
+// names to args. They're generated in the order they're given, so that
+// a global arg can use those before it (e.g. with arg("region")).
+type GlobalArgs Args
+
+func (g *GlobalArgs) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid global args: should be a mapping of names to args")
+	}
+
+	var args Args
+	if err := node.Decode(&args); err != nil {
+		return err
+	}
+
+	*g = GlobalArgs(args)
+	return nil
+}
+
+// named returns true if the args are bound by name.
+func (a Args) named() bool {
+	return len(a) > 0 && a[0].name != ""
+}
+
+// namedValues maps the names of named args to their generated values,
+// returning nil for positional args.
+func namedValues(args Args, values []any) map[string]any {
+	if !args.named() {
+		return nil
+	}
+
+	named := make(map[string]any, len(args))
+	for i, arg := range args {
+		named[arg.name] = values[i]
+	}
+
+	return named
+}
+
+// namedStatement is a query rewritten from named parameters into a
+// driver's placeholders.
+type namedStatement struct {
+	stmt string
+
+	// The index of the arg bound to each placeholder, in order.
+	indexes []int
+}
+
+// bind orders a query's generated args for its rewritten statement.
+func (ns *namedStatement) bind(args []any) []any {
+	bound := make([]any, len(ns.indexes))
+	for i, index := range ns.indexes {
+		bound[i] = args[index]
+	}
+
+	return bound
+}
+
+// namedKey identifies a query's named statement, as queries with the
+// same text can name their args differently.
+func namedKey(q Query) string {
+	names := make([]string, len(q.Args))
+	for i, arg := range q.Args {
+		names[i] = arg.name
+	}
+
+	return q.Query + "\x00" + strings.Join(names, ",")
+}
+
+// parseNamedStatements rewrites every activity (and tx statement) with
+// named args for a driver, keyed by namedKey. Templated queries are
+// skipped, as they bind their values with "bind".
+func parseNamedStatements(activities map[string]Query, driver string) (map[string]*namedStatement, error) {
+	statements := map[string]*namedStatement{}
+
+	add := func(name string, q Query) error {
+		if !q.Args.named() || q.Template {
+			return nil
+		}
+
+		ns, err := rewriteNamed(q.Query, q.Args, driver)
+		if err != nil {
+			return fmt.Errorf("rewriting named args for %q: %w", name, err)
+		}
+
+		statements[namedKey(q)] = ns
+		return nil
+	}
+
+	for name, q := range activities {
+		if err := add(name, q); err != nil {
+			return nil, err
+		}
+
+		for _, stmt := range q.Statements {
+			if err := add(name+"."+stmt.Name, stmt.Query); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return statements, nil
+}
+
+// rewriteNamed replaces the :name and {{name}} parameters of a query
+// with a driver's placeholders. String literals, quoted identifiers,
+// comments, and casts (::type) are left untouched. For mysql and
+// oracle, whose drivers bind one value per placeholder, a parameter
+// used more than once is given a placeholder (and bound) per use.
+func rewriteNamed(query string, args Args, driver string) (*namedStatement, error) {
+	indexes := map[string]int{}
+	for i, arg := range args {
+		indexes[arg.name] = i
+	}
+
+	var sb strings.Builder
+	ns := namedStatement{}
+	placeholders := map[string]string{}
+
+	param := func(name string) error {
+		index, ok := indexes[name]
+		if !ok {
+			return fmt.Errorf("missing arg: %q", name)
+		}
+
+		if p, ok := placeholders[name]; ok && !bindsPerPlaceholder(driver) {
+			sb.WriteString(p)
+			return nil
+		}
+
+		ns.indexes = append(ns.indexes, index)
+		p := placeholder(driver, len(ns.indexes))
+		placeholders[name] = p
+		sb.WriteString(p)
+		return nil
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		// String literals and quoted identifiers.
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(query) {
+				if query[end] == c {
+					// Doubled quotes are escaped quotes.
+					if end+1 < len(query) && query[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			end = min(end+1, len(query))
+			sb.WriteString(query[i:end])
+			i = end
+
+		// Line comments.
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query) - i
+			}
+			sb.WriteString(query[i : i+end])
+			i += end
+
+		// Block comments.
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			sb.WriteString(query[i : i+end])
+			i += end
+
+		// Casts.
+		case strings.HasPrefix(query[i:], "::"):
+			sb.WriteString("::")
+			i += 2
+
+		// :name parameters.
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 2
+			for end < len(query) && isNameByte(query[end]) {
+				end++
+			}
+			if err := param(query[i+1 : end]); err != nil {
+				return nil, err
+			}
+			i = end
+
+		// {{name}} parameters.
+		case strings.HasPrefix(query[i:], "{{"):
+			end := strings.Index(query[i:], "}}")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated parameter: %q", query[i:])
+			}
+			if err := param(strings.TrimSpace(query[i+2 : i+end])); err != nil {
+				return nil, err
+			}
+			i += end + 2
+
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	ns.stmt = sb.String()
+	return &ns, nil
+}
+
+// bindsPerPlaceholder returns true if a driver binds a separate value
+// to every occurrence of a placeholder. go-ora only reuses a value for
+// a repeated placeholder when it's bound with sql.Named.
+func bindsPerPlaceholder(driver string) bool {
+	return driver == "mysql" || driver == "oracle"
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameByte(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
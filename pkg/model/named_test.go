@@ -0,0 +1,188 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestArgsUnmarshalYAML(t *testing.T) {
+	var list Args
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+- type: const
+  value: 1
+- type: const
+  value: 2`), &list))
+	assert.Len(t, list, 2)
+	assert.False(t, list.named())
+
+	var named Args
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+email:
+  type: const
+  value: a@example.com
+id:
+  type: const
+  value: 1`), &named))
+	assert.True(t, named.named())
+	assert.Equal(t, "email", named[0].name)
+	assert.Equal(t, "id", named[1].name)
+
+	var invalid Args
+	assert.EqualError(t, yaml.Unmarshal([]byte(`
+shopper-id:
+  type: const
+  value: 1`), &invalid), "invalid arg name: \"shopper-id\" (should contain only letters, numbers, and underscores)")
+}
+
+func TestRewriteNamed(t *testing.T) {
+	args := Args{{name: "id"}, {name: "email"}}
+
+	cases := []struct {
+		name       string
+		query      string
+		driver     string
+		expStmt    string
+		expIndexes []int
+		expErr     string
+	}{
+		{
+			name:       "pgx",
+			query:      "UPDATE shopper SET email = :email WHERE id = :id",
+			driver:     "pgx",
+			expStmt:    "UPDATE shopper SET email = $1 WHERE id = $2",
+			expIndexes: []int{1, 0},
+		},
+		{
+			name:       "mysql",
+			query:      "UPDATE shopper SET email = :email WHERE id = :id",
+			driver:     "mysql",
+			expStmt:    "UPDATE shopper SET email = ? WHERE id = ?",
+			expIndexes: []int{1, 0},
+		},
+		{
+			name:       "oracle",
+			query:      "UPDATE shopper SET email = :email WHERE id = :id",
+			driver:     "oracle",
+			expStmt:    "UPDATE shopper SET email = :1 WHERE id = :2",
+			expIndexes: []int{1, 0},
+		},
+		{
+			name:       "spanner",
+			query:      "UPDATE shopper SET email = {{email}} WHERE id = {{ id }}",
+			driver:     "spanner",
+			expStmt:    "UPDATE shopper SET email = @p1 WHERE id = @p2",
+			expIndexes: []int{1, 0},
+		},
+		{
+			name:       "repeated pgx",
+			query:      "SELECT :id, :id",
+			driver:     "pgx",
+			expStmt:    "SELECT $1, $1",
+			expIndexes: []int{0},
+		},
+		{
+			name:       "repeated mysql",
+			query:      "SELECT :id, :id",
+			driver:     "mysql",
+			expStmt:    "SELECT ?, ?",
+			expIndexes: []int{0, 0},
+		},
+		{
+			name:       "repeated oracle",
+			query:      "SELECT :id, :email, :id",
+			driver:     "oracle",
+			expStmt:    "SELECT :1, :2, :3",
+			expIndexes: []int{0, 1, 0},
+		},
+		{
+			name:       "repeated spanner",
+			query:      "SELECT {{id}}, {{id}}",
+			driver:     "spanner",
+			expStmt:    "SELECT @p1, @p1",
+			expIndexes: []int{0},
+		},
+		{
+			name:       "casts, strings, and comments",
+			query:      "SELECT :id::UUID, ':email', \":email\", '12:30', 'it''s :email' -- :email\n/* :email */ FROM t",
+			driver:     "pgx",
+			expStmt:    "SELECT $1::UUID, ':email', \":email\", '12:30', 'it''s :email' -- :email\n/* :email */ FROM t",
+			expIndexes: []int{0},
+		},
+		{
+			name:   "unknown name",
+			query:  "SELECT :name",
+			driver: "pgx",
+			expErr: "missing arg: \"name\"",
+		},
+		{
+			name:   "unterminated",
+			query:  "SELECT {{id",
+			driver: "pgx",
+			expErr: "unterminated parameter: \"{{id\"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := rewriteNamed(c.query, args, c.driver)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expStmt, act.stmt)
+			assert.Equal(t, c.expIndexes, act.indexes)
+		})
+	}
+}
+
+func TestRunQueryNamed(t *testing.T) {
+	var execStmt string
+	var execArgs []any
+
+	queryer := mockQueryer{
+		exec: func(query string, args ...any) (time.Duration, error) {
+			execStmt, execArgs = query, args
+			return 0, nil
+		},
+	}
+
+	var query Query
+	err := yaml.Unmarshal([]byte(`
+type: exec
+args:
+  id:
+    type: const
+    value: 1
+  email:
+    type: const
+    value: a@example.com
+query: UPDATE shopper SET email = :email WHERE id = :id`), &query)
+	assert.NoError(t, err)
+
+	cfg := &Drk{Activities: map[string]Query{"update_shopper": query}}
+
+	for driver, expStmt := range map[string]string{
+		"pgx":   "UPDATE shopper SET email = $1 WHERE id = $2",
+		"mysql": "UPDATE shopper SET email = ? WHERE id = ?",
+	} {
+		r, err := NewRunner(cfg, &queryer, EnvironmentVariables{Driver: driver}, make(chan int, 1), &zerolog.Logger{})
+		assert.NoError(t, err)
+
+		_, _, err = r.runQuery(context.Background(), NewVU(r), query)
+		assert.NoError(t, err)
+		assert.Equal(t, expStmt, execStmt)
+		assert.Equal(t, []any{"a@example.com", 1}, execArgs)
+	}
+
+	_, err = NewRunner(&Drk{Activities: map[string]Query{
+		"invalid": {Query: "SELECT :missing", Args: Args{{name: "id"}}},
+	}}, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.EqualError(t, err, "parsing named args: rewriting named args for \"invalid\": missing arg: \"missing\"")
+}
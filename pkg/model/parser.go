@@ -2,7 +2,6 @@ package model
 
 import (
 	"fmt"
-	"math/rand/v2"
 	"os"
 	"strings"
 	"time"
@@ -28,6 +27,11 @@ func parseArgTypeGen(raw map[string]any) (genFunc, dependencyFunc, error) {
 }
 
 func parseArgTypeScalar(argType string, raw map[string]any) (genFunc, dependencyFunc, error) {
+	dist, err := parseDistribution(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing distribution: %w", err)
+	}
+
 	return func(vu *VU) (any, error) {
 		switch strings.ToLower(argType) {
 		case "int":
@@ -36,7 +40,7 @@ func parseArgTypeScalar(argType string, raw map[string]any) (genFunc, dependency
 				return nil, err
 			}
 
-			return Int(min, max), nil
+			return dist.Int(min, max), nil
 
 		case "float":
 			min, max, err := parseMinMax[float64](raw)
@@ -44,7 +48,7 @@ func parseArgTypeScalar(argType string, raw map[string]any) (genFunc, dependency
 				return nil, err
 			}
 
-			return Float(min, max), nil
+			return dist.Float(min, max), nil
 
 		case "timestamp":
 			minStr, maxStr, err := parseMinMax[string](raw)
@@ -72,7 +76,7 @@ func parseArgTypeScalar(argType string, raw map[string]any) (genFunc, dependency
 				return nil, fmt.Errorf("parsing max as timestamp: %w", err)
 			}
 
-			return Timestamp(min, max), nil
+			return dist.Timestamp(min, max), nil
 
 		case "interval", "duration":
 			minStr, maxStr, err := parseMinMax[string](raw)
@@ -90,7 +94,7 @@ func parseArgTypeScalar(argType string, raw map[string]any) (genFunc, dependency
 				return nil, fmt.Errorf("parsing max as duration: %w", err)
 			}
 
-			return Interval(min, max), nil
+			return dist.Interval(min, max), nil
 
 		case "location", "point":
 			lat, err := parseField[float64](raw, "lat")
@@ -128,6 +132,43 @@ func parseArgTypeRef(raw map[string]any) (genFunc, dependencyFunc, error) {
 		return nil, nil, fmt.Errorf("parsing column: %w", err)
 	}
 
+	dist, err := parseDistribution(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing distribution: %w", err)
+	}
+
+	pick, err := parseField[string](raw, "pick")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing pick: %w", err)
+		}
+		pick = string(RefPickRandom)
+	}
+
+	switch RefPick(pick) {
+	case RefPickRandom, RefPickFirst, RefPickLast, RefPickSequential, RefPickUnique, RefPickAll:
+	default:
+		return nil, nil, fmt.Errorf("invalid pick: %q (should be one of: %s, %s, %s, %s, %s, %s)",
+			pick, RefPickRandom, RefPickFirst, RefPickLast, RefPickSequential, RefPickUnique, RefPickAll)
+	}
+
+	bind, err := parseField[string](raw, "bind")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing bind: %w", err)
+		}
+	}
+
+	if bind != "" && RefPick(pick) == RefPickAll {
+		return nil, nil, fmt.Errorf("invalid bind: not supported with pick: %s", RefPickAll)
+	}
+
+	source := &refSource{
+		query: queryRef,
+		pick:  RefPick(pick),
+		dist:  dist,
+	}
+
 	genFunc := func(vu *VU) (any, error) {
 		vu.dataMu.RLock()
 		defer vu.dataMu.RUnlock()
@@ -141,8 +182,25 @@ func parseArgTypeRef(raw map[string]any) (genFunc, dependencyFunc, error) {
 			return nil, fmt.Errorf("no data found for %s - %s", queryRef, columnRef)
 		}
 
-		row := rand.IntN(len(query))
-		cell, ok := query[row][columnRef]
+		if source.pick == RefPickAll {
+			cells := make([]any, len(query))
+			for i, row := range query {
+				if cells[i], ok = row[columnRef]; !ok {
+					return nil, fmt.Errorf("missing column: %q", columnRef)
+				}
+			}
+
+			return bindArray(cells, defaultArrayFormat(vu.r.driver), defaultArrayDelimiter)
+		}
+
+		row, err := vu.bindRow(bind, "ref:"+queryRef, func() (map[string]any, error) {
+			return source.next(vu, query, vu.dataVersions[queryRef])
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		cell, ok := row[columnRef]
 		if !ok {
 			return nil, fmt.Errorf("missing column: %q", columnRef)
 		}
@@ -163,7 +221,7 @@ func parseArgTypeRef(raw map[string]any) (genFunc, dependencyFunc, error) {
 		return ok
 	}
 
-	return genFunc, depFunc, err
+	return genFunc, depFunc, nil
 }
 
 func parseArgTypeSet(raw map[string]any) (genFunc, dependencyFunc, error) {
@@ -240,19 +298,13 @@ func parseArgTypeExpr(raw map[string]any) (genFunc, dependencyFunc, error) {
 		return nil, nil, fmt.Errorf("parsing value: %w", err)
 	}
 
-	env := map[string]any{
-		"env": func(name string) string {
-			return os.Getenv(name)
-		},
-	}
-
-	program, err := expr.Compile(value, expr.Env(env))
+	program, err := expr.Compile(value, expr.Env(exprEnv(nil)))
 	if err != nil {
 		return nil, nil, fmt.Errorf("compiling expression: %w", err)
 	}
 
 	genFunc := func(vu *VU) (any, error) {
-		return expr.Run(program, env)
+		return expr.Run(program, exprEnv(vu))
 	}
 
 	return genFunc, dependencyFuncNoop, nil
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -869,7 +871,7 @@ func TestParseArgTypeEnv(t *testing.T) {
 				return
 			}
 
-			noopChan := make(chan struct{}, 1)
+			noopChan := make(chan int, 1)
 
 			r, err := NewRunner(&Drk{
 				EnvMappings: map[string]EnvMapping{
@@ -984,3 +986,585 @@ func TestParseArgTypeExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestParseArgTypeArray(t *testing.T) {
+	pgxVU := NewVU(&Runner{driver: "pgx", logger: &zerolog.Logger{}})
+	mysqlVU := NewVU(&Runner{driver: "mysql", logger: &zerolog.Logger{}})
+
+	cases := []struct {
+		name             string
+		raw              map[string]any
+		genFuncValidator func(t *testing.T, f genFunc)
+		expErr           error
+	}{
+		{
+			name: "gen value shorthand",
+			raw: map[string]any{
+				"min":   1,
+				"max":   5,
+				"value": "email",
+			},
+			genFuncValidator: func(t *testing.T, f genFunc) {
+				raw, err := f(pgxVU)
+				assert.NoError(t, err)
+
+				value := raw.([]string)
+				assert.GreaterOrEqual(t, len(value), 1)
+				assert.LessOrEqual(t, len(value), 5)
+				for _, v := range value {
+					assert.Contains(t, v, "@")
+				}
+			},
+		},
+		{
+			name: "nested set arg",
+			raw: map[string]any{
+				"min": 3,
+				"max": 3,
+				"arg": map[string]any{
+					"type":   "set",
+					"values": []any{1},
+				},
+			},
+			genFuncValidator: func(t *testing.T, f genFunc) {
+				raw, err := f(pgxVU)
+				assert.NoError(t, err)
+				assert.Equal(t, []int64{1, 1, 1}, raw)
+			},
+		},
+		{
+			name: "empty array",
+			raw: map[string]any{
+				"min":   0,
+				"max":   0,
+				"value": "email",
+			},
+			genFuncValidator: func(t *testing.T, f genFunc) {
+				raw, err := f(pgxVU)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{}, raw)
+			},
+		},
+		{
+			name: "json by default for mysql",
+			raw: map[string]any{
+				"min": 2,
+				"max": 2,
+				"arg": map[string]any{
+					"type":  "const",
+					"value": "a",
+				},
+			},
+			genFuncValidator: func(t *testing.T, f genFunc) {
+				raw, err := f(mysqlVU)
+				assert.NoError(t, err)
+				assert.Equal(t, `["a","a"]`, raw)
+			},
+		},
+		{
+			name: "delimited",
+			raw: map[string]any{
+				"min":       2,
+				"max":       2,
+				"format":    "delimited",
+				"delimiter": "|",
+				"arg": map[string]any{
+					"type":  "const",
+					"value": "a",
+				},
+			},
+			genFuncValidator: func(t *testing.T, f genFunc) {
+				raw, err := f(pgxVU)
+				assert.NoError(t, err)
+				assert.Equal(t, "a|a", raw)
+			},
+		},
+		{
+			name: "missing min",
+			raw: map[string]any{
+				"max":   5,
+				"value": "email",
+			},
+			expErr: FieldMissingErr{Name: "min"},
+		},
+		{
+			name: "min greater than max",
+			raw: map[string]any{
+				"min":   5,
+				"max":   1,
+				"value": "email",
+			},
+			expErr: fmt.Errorf("invalid array size: min (5) should be between 0 and max (1)"),
+		},
+		{
+			name: "missing element arg",
+			raw: map[string]any{
+				"min": 1,
+				"max": 5,
+			},
+			expErr: FieldMissingErr{Name: "arg"},
+		},
+		{
+			name: "invalid format",
+			raw: map[string]any{
+				"min":    1,
+				"max":    5,
+				"value":  "email",
+				"format": "xml",
+			},
+			expErr: fmt.Errorf("invalid array format: \"xml\" (should be one of: native, json, delimited)"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gen, _, _, err := parseArgTypeArray(c.raw)
+			if c.expErr != nil {
+				assert.ErrorContains(t, err, c.expErr.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			c.genFuncValidator(t, gen)
+		})
+	}
+}
+
+func TestParseArgTypeSeq(t *testing.T) {
+	newVU := func(id int, workflow string) *VU {
+		vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+		vu.id = id
+		vu.workflow = workflow
+		return vu
+	}
+
+	cases := []struct {
+		name   string
+		raw    map[string]any
+		vus    []*VU
+		exp    []any
+		expErr error
+	}{
+		{
+			name: "defaults",
+			raw:  map[string]any{},
+			vus:  []*VU{newVU(0, "a"), newVU(1, "b"), newVU(0, "a")},
+			exp:  []any{int64(1), int64(2), int64(3)},
+		},
+		{
+			name: "start and step",
+			raw:  map[string]any{"start": 10, "step": -5},
+			vus:  []*VU{newVU(0, "a"), newVU(0, "a"), newVU(0, "a")},
+			exp:  []any{int64(10), int64(5), int64(0)},
+		},
+		{
+			name: "format",
+			raw:  map[string]any{"format": "user-%08d"},
+			vus:  []*VU{newVU(0, "a"), newVU(0, "a")},
+			exp:  []any{"user-00000001", "user-00000002"},
+		},
+		{
+			name: "workflow scope",
+			raw:  map[string]any{"scope": "workflow"},
+			vus:  []*VU{newVU(0, "a"), newVU(1, "b"), newVU(2, "a")},
+			exp:  []any{int64(1), int64(1), int64(2)},
+		},
+		{
+			name: "vu scope with block",
+			raw:  map[string]any{"scope": "vu", "start": 0, "block": 100},
+			vus:  []*VU{newVU(0, "a"), newVU(2, "a")},
+			exp:  []any{int64(0), int64(200)},
+		},
+		{
+			name:   "invalid scope",
+			raw:    map[string]any{"scope": "tenant"},
+			expErr: fmt.Errorf("invalid scope: \"tenant\" (should be one of: vu, workflow, global)"),
+		},
+		{
+			name:   "zero step",
+			raw:    map[string]any{"step": 0},
+			expErr: fmt.Errorf("invalid step: 0 (should be non-zero)"),
+		},
+		{
+			name:   "block without vu scope",
+			raw:    map[string]any{"block": 100},
+			expErr: fmt.Errorf("invalid block: only supported for vu scope"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gen, _, err := parseArgTypeSeq(c.raw)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			for i, vu := range c.vus {
+				act, err := gen(vu)
+				assert.NoError(t, err)
+				assert.Equal(t, c.exp[i], act)
+			}
+		})
+	}
+}
+
+func TestParseArgTypeSeqVUScope(t *testing.T) {
+	gen, _, err := parseArgTypeSeq(map[string]any{"scope": "vu", "block": 2})
+	assert.NoError(t, err)
+
+	vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+	vu.id = 1
+
+	other := NewVU(&Runner{logger: &zerolog.Logger{}})
+
+	for _, exp := range []int64{3, 4} {
+		act, err := gen(vu)
+		assert.NoError(t, err)
+		assert.Equal(t, exp, act)
+	}
+
+	act, err := gen(other)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), act)
+
+	_, err = gen(vu)
+	assert.EqualError(t, err, "sequence block exhausted for vu 1 (block: 2)")
+}
+
+func TestParseArgTypeSeqConcurrent(t *testing.T) {
+	gen, _, err := parseArgTypeSeq(map[string]any{})
+	assert.NoError(t, err)
+
+	const vus, perVU = 10, 100
+
+	var mu sync.Mutex
+	seen := map[any]struct{}{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < vus; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+			for j := 0; j < perVU; j++ {
+				v, err := gen(vu)
+				assert.NoError(t, err)
+
+				mu.Lock()
+				seen[v] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, vus*perVU)
+}
+
+func TestParseArgTypeFile(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	csvPath := write("users.csv", "id,email\n1,a@example.com\n2,b@example.com\n3,c@example.com\n")
+	jsonlPath := write("users.jsonl", `{"id": 1, "score": 1.5}`+"\n\n"+`{"id": 2, "score": 2.5}`+"\n")
+	linesPath := write("names.txt", "alice\n\nbob\n")
+
+	cases := []struct {
+		name    string
+		raw     map[string]any
+		expVals []any
+		expErr  string
+	}{
+		{
+			name:    "csv sequential",
+			raw:     map[string]any{"path": csvPath, "column": "email", "pick": "sequential"},
+			expVals: []any{"a@example.com", "b@example.com", "c@example.com", "a@example.com"},
+		},
+		{
+			name:    "jsonl sequential",
+			raw:     map[string]any{"path": jsonlPath, "column": "id", "pick": "sequential"},
+			expVals: []any{int64(1), int64(2), int64(1)},
+		},
+		{
+			name:    "jsonl floats",
+			raw:     map[string]any{"path": jsonlPath, "column": "score", "pick": "sequential"},
+			expVals: []any{1.5, 2.5},
+		},
+		{
+			name:    "lines sequential",
+			raw:     map[string]any{"path": linesPath, "pick": "sequential"},
+			expVals: []any{"alice", "bob", "alice"},
+		},
+		{
+			name:    "explicit format",
+			raw:     map[string]any{"path": csvPath, "format": "lines", "pick": "sequential"},
+			expVals: []any{"id,email", "1,a@example.com"},
+		},
+		{
+			name:   "sequential stop",
+			raw:    map[string]any{"path": linesPath, "pick": "sequential", "on_end": "stop"},
+			expErr: fmt.Sprintf("reading %q: data source exhausted", linesPath),
+		},
+		{
+			name:   "unique",
+			raw:    map[string]any{"path": linesPath, "pick": "unique"},
+			expErr: fmt.Sprintf("reading %q: data source exhausted", linesPath),
+		},
+		{
+			name:   "missing csv column",
+			raw:    map[string]any{"path": csvPath},
+			expErr: fmt.Errorf("parsing column: %w", FieldMissingErr{Name: "column"}).Error(),
+		},
+		{
+			name:   "unknown column",
+			raw:    map[string]any{"path": csvPath, "column": "name"},
+			expErr: "missing column: \"name\"",
+		},
+		{
+			name:   "invalid pick",
+			raw:    map[string]any{"path": csvPath, "column": "id", "pick": "shuffle"},
+			expErr: "invalid pick: \"shuffle\" (should be one of: random, sequential, unique)",
+		},
+		{
+			name:   "missing file",
+			raw:    map[string]any{"path": filepath.Join(dir, "missing.csv"), "column": "id"},
+			expErr: "loading file: opening file",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gen, _, err := parseArgTypeFile(c.raw)
+			if err != nil {
+				assert.ErrorContains(t, err, c.expErr)
+				return
+			}
+
+			vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+
+			var act []any
+			for {
+				v, err := gen(vu)
+				if err != nil {
+					assert.ErrorIs(t, err, ErrSourceExhausted)
+					assert.EqualError(t, err, c.expErr)
+					break
+				}
+
+				act = append(act, v)
+				if len(act) == len(c.expVals) {
+					break
+				}
+			}
+
+			if c.expVals != nil {
+				assert.Equal(t, c.expVals, act)
+			}
+		})
+	}
+}
+
+func TestParseArgTypeFileBind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("id,email\n1,a@example.com\n2,b@example.com\n"), 0o644))
+
+	var args []Arg
+	for _, column := range []string{"id", "email"} {
+		var arg Arg
+		assert.NoError(t, arg.parse(map[string]any{"type": "file", "path": path, "column": column, "bind": "user"}))
+		args = append(args, arg)
+	}
+
+	vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+
+	for range 100 {
+		values, err := vu.generateArgs(args)
+		assert.NoError(t, err)
+
+		exp := map[any]any{"1": "a@example.com", "2": "b@example.com"}
+		assert.Equal(t, exp[values[0]], values[1])
+	}
+}
+
+func TestParseArgTypeRefPick(t *testing.T) {
+	rows := []map[string]any{
+		{"id": "a"},
+		{"id": "b"},
+		{"id": "c"},
+	}
+
+	cases := []struct {
+		name    string
+		pick    string
+		driver  string
+		expVals []any
+		expErr  string
+	}{
+		{name: "first", pick: "first", expVals: []any{"a", "a"}},
+		{name: "last", pick: "last", expVals: []any{"c", "c"}},
+		{name: "sequential", pick: "sequential", expVals: []any{"a", "b", "c", "a"}},
+		{name: "unique", pick: "unique", expVals: []any{"a", "b", "c"}, expErr: "reading \"table\": data source exhausted"},
+		{name: "all native", pick: "all", driver: "pgx", expVals: []any{[]string{"a", "b", "c"}}},
+		{name: "all json", pick: "all", driver: "mysql", expVals: []any{`["a","b","c"]`}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gen, _, err := parseArgTypeRef(map[string]any{
+				"query":  "table",
+				"column": "id",
+				"pick":   c.pick,
+			})
+			assert.NoError(t, err)
+
+			vu := NewVU(&Runner{driver: c.driver, logger: &zerolog.Logger{}})
+			vu.applyData("table", rows)
+
+			for _, exp := range c.expVals {
+				act, err := gen(vu)
+				assert.NoError(t, err)
+				assert.Equal(t, exp, act)
+			}
+
+			if c.expErr != "" {
+				_, err := gen(vu)
+				assert.ErrorIs(t, err, ErrSourceExhausted)
+				assert.EqualError(t, err, c.expErr)
+
+				// Replacing the data resets the cursor.
+				vu.applyData("table", rows)
+				act, err := gen(vu)
+				assert.NoError(t, err)
+				assert.Equal(t, "a", act)
+			}
+		})
+	}
+}
+
+func TestParseArgTypeRefInvalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		raw    map[string]any
+		expErr string
+	}{
+		{
+			name:   "invalid pick",
+			raw:    map[string]any{"query": "table", "column": "id", "pick": "middle"},
+			expErr: "invalid pick: \"middle\" (should be one of: random, first, last, sequential, unique, all)",
+		},
+		{
+			name:   "bind with all",
+			raw:    map[string]any{"query": "table", "column": "id", "pick": "all", "bind": "order"},
+			expErr: "invalid bind: not supported with pick: all",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := parseArgTypeRef(c.raw)
+			assert.EqualError(t, err, c.expErr)
+		})
+	}
+}
+
+func TestParseArgTypeRefBind(t *testing.T) {
+	var args []Arg
+	for _, raw := range []map[string]any{
+		{"type": "ref", "query": "fetch_orders", "column": "order_id", "bind": "order"},
+		{"type": "ref", "query": "fetch_orders", "column": "shopper_id", "bind": "order"},
+		{"type": "int", "min": 1, "max": 10},
+	} {
+		var arg Arg
+		assert.NoError(t, arg.parse(raw))
+		args = append(args, arg)
+	}
+
+	vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+	vu.applyData("fetch_orders", []map[string]any{
+		{"order_id": "o1", "shopper_id": "s1"},
+		{"order_id": "o2", "shopper_id": "s2"},
+		{"order_id": "o3", "shopper_id": "s3"},
+	})
+
+	exp := map[any]any{"o1": "s1", "o2": "s2", "o3": "s3"}
+
+	for range 100 {
+		values, err := vu.generateArgs(args)
+		assert.NoError(t, err)
+		assert.Equal(t, exp[values[0]], values[1])
+	}
+}
+
+func TestBindRowDifferentSources(t *testing.T) {
+	vu := NewVU(&Runner{logger: &zerolog.Logger{}}).forCall()
+
+	pick := func() (map[string]any, error) {
+		return map[string]any{"id": 1}, nil
+	}
+
+	_, err := vu.bindRow("x", "ref:a", pick)
+	assert.NoError(t, err)
+
+	_, err = vu.bindRow("x", "ref:b", pick)
+	assert.EqualError(t, err, "bind \"x\" used for different sources: ref:a and ref:b")
+}
+
+func TestParseArgTypeExprVU(t *testing.T) {
+	r := &Runner{logger: &zerolog.Logger{}, started: time.Now().Add(-time.Minute)}
+	r.globalArgs = globalArgs{m: map[string]any{"region": "eu"}}
+
+	vu := NewVU(r)
+	vu.id = 3
+	vu.workflow = "checkout"
+	vu.iteration = 7
+	vu.applyData("create_shopper", []map[string]any{{"id": "s1"}, {"id": "s2"}})
+
+	cases := []struct {
+		name   string
+		value  string
+		exp    any
+		expErr string
+	}{
+		{name: "vu", value: `vu`, exp: 3},
+		{name: "workflow", value: `workflow + "-" + string(iteration)`, exp: "checkout-7"},
+		{name: "elapsed", value: `elapsed > duration("30s") ? "late" : "early"`, exp: "late"},
+		{name: "data", value: `data("create_shopper")[1].id`, exp: "s2"},
+		{name: "data length", value: `len(data("missing"))`, exp: 0},
+		{name: "global", value: `global("region")`, exp: "eu"},
+		{name: "previous args", value: `arg(0) * arg(1)`, exp: 6},
+		{name: "gen", value: `gen("email") contains "@"`, exp: true},
+		{name: "missing arg", value: `arg(2)`, expErr: "missing arg: 2 (2 generated so far)"},
+		{name: "missing global", value: `global("zone")`, expErr: "missing global arg: \"zone\""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var args []Arg
+			for _, raw := range []map[string]any{
+				{"type": "const", "value": 2},
+				{"type": "const", "value": 3},
+				{"type": "expr", "value": c.value},
+			} {
+				var arg Arg
+				assert.NoError(t, arg.parse(raw))
+				args = append(args, arg)
+			}
+
+			values, err := vu.generateArgs(args)
+			if c.expErr != "" {
+				assert.ErrorContains(t, err, c.expErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, values[2])
+		})
+	}
+}
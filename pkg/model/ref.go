@@ -0,0 +1,68 @@
+package model
+
+import "fmt"
+
+// RefPick determines how a ref arg selects rows from the referenced
+// query's data.
+type RefPick string
+
+const (
+	// RefPickRandom selects a random row (using the arg's distribution,
+	// if provided).
+	RefPickRandom RefPick = "random"
+
+	// RefPickFirst selects the first row.
+	RefPickFirst RefPick = "first"
+
+	// RefPickLast selects the last row.
+	RefPickLast RefPick = "last"
+
+	// RefPickSequential selects rows in order, wrapping back to the first
+	// row once every row has been used.
+	RefPickSequential RefPick = "sequential"
+
+	// RefPickUnique selects rows in order, using each row once.
+	RefPickUnique RefPick = "unique"
+
+	// RefPickAll selects every row, binding the column as an array.
+	RefPickAll RefPick = "all"
+)
+
+// refSource selects rows from a VU's data for a ref arg.
+type refSource struct {
+	query string
+	pick  RefPick
+	dist  *Distribution
+}
+
+// refCursor is a VU's position in a ref arg's rows. Cursors reset when
+// the referenced query's data is replaced.
+type refCursor struct {
+	version int
+	n       int
+}
+
+// next returns the next row for a VU, given the referenced query's
+// current rows and their version.
+func (s *refSource) next(vu *VU, rows []map[string]any, version int) (map[string]any, error) {
+	switch s.pick {
+	case RefPickFirst:
+		return rows[0], nil
+
+	case RefPickLast:
+		return rows[len(rows)-1], nil
+
+	case RefPickSequential:
+		return rows[vu.nextRef(s, version)%len(rows)], nil
+
+	case RefPickUnique:
+		i := vu.nextRef(s, version)
+		if i >= len(rows) {
+			return nil, fmt.Errorf("reading %q: %w", s.query, ErrSourceExhausted)
+		}
+		return rows[i], nil
+
+	default:
+		return rows[s.dist.sample(len(rows))], nil
+	}
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"gopkg.in/yaml.v3"
+)
+
+// retryOnAny matches every error in a retry policy's "on" list.
+const retryOnAny = "any"
+
+// RetryPolicy determines how an activity is retried when it fails.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times the activity is run,
+	// including the first.
+	Attempts int `yaml:"attempts"`
+
+	// Backoff is the delay before the first retry, which is multiplied
+	// by Multiplier for each retry after it, up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	Multiplier float64       `yaml:"multiplier"`
+
+	// Jitter is the fraction of each delay that's randomised, to stop
+	// VUs that failed together from retrying together.
+	Jitter float64 `yaml:"jitter"`
+
+	// Timeout is the time allowed for each attempt. If zero, the
+	// --query-timeout argument is used.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// On lists the error categories (see repo.ErrorCategory) and
+	// driver codes that are retried, or "any" to retry every error.
+	On []string `yaml:"on"`
+}
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = time.Millisecond * 10
+	defaultRetryMaxBackoff = time.Second
+	defaultRetryMultiplier = 2
+	defaultRetryJitter     = 0.2
+)
+
+func (p *RetryPolicy) UnmarshalYAML(node *yaml.Node) error {
+	type rawRetryPolicy RetryPolicy
+
+	raw := rawRetryPolicy{
+		Attempts:   defaultRetryAttempts,
+		Backoff:    defaultRetryBackoff,
+		MaxBackoff: defaultRetryMaxBackoff,
+		Multiplier: defaultRetryMultiplier,
+		Jitter:     defaultRetryJitter,
+		On:         []string{string(repo.ErrorCategoryRetryable)},
+	}
+
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	if raw.Attempts < 1 {
+		return fmt.Errorf("invalid retry attempts: %d (should be at least 1)", raw.Attempts)
+	}
+
+	if raw.Multiplier < 1 {
+		return fmt.Errorf("invalid retry multiplier: %g (should be at least 1)", raw.Multiplier)
+	}
+
+	if raw.Jitter < 0 || raw.Jitter > 1 {
+		return fmt.Errorf("invalid retry jitter: %g (should be between 0 and 1)", raw.Jitter)
+	}
+
+	*p = RetryPolicy(raw)
+	return nil
+}
+
+// defaultRetryPolicy is used by activities without a retry policy,
+// retrying every error after a fixed delay.
+func defaultRetryPolicy(e EnvironmentVariables) RetryPolicy {
+	return RetryPolicy{
+		Attempts:   max(e.Retries, 1),
+		Backoff:    defaultRetryBackoff,
+		Multiplier: 1,
+		Timeout:    e.QueryTimeout,
+		On:         []string{retryOnAny},
+	}
+}
+
+// retries returns true if an error should be retried, based on its
+// category and driver code.
+func (p RetryPolicy) retries(err error) bool {
+	class := repo.Classify(err)
+
+	for _, on := range p.On {
+		if on == retryOnAny || on == string(class.Category) || (class.Code != "" && strings.EqualFold(on, class.Code)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay returns the time to wait before the given retry (starting at
+// 1), with jitter applied.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := float64(p.Backoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// attemptContext returns the context for a single attempt, which is
+// bounded by the policy's timeout (or the default timeout if unset).
+func (p RetryPolicy) attemptContext(ctx context.Context, defaultTimeout time.Duration) (context.Context, context.CancelFunc) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
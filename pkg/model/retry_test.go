@@ -0,0 +1,196 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetryPolicyUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    RetryPolicy
+		expErr string
+	}{
+		{
+			name: "defaults",
+			yaml: `attempts: 3`,
+			exp: RetryPolicy{
+				Attempts:   3,
+				Backoff:    defaultRetryBackoff,
+				MaxBackoff: defaultRetryMaxBackoff,
+				Multiplier: defaultRetryMultiplier,
+				Jitter:     defaultRetryJitter,
+				On:         []string{"retryable"},
+			},
+		},
+		{
+			name: "overrides",
+			yaml: `
+attempts: 5
+backoff: 50ms
+max_backoff: 2s
+multiplier: 3
+jitter: 0
+timeout: 1s
+on: [retryable, timeout, "23505"]`,
+			exp: RetryPolicy{
+				Attempts:   5,
+				Backoff:    time.Millisecond * 50,
+				MaxBackoff: time.Second * 2,
+				Multiplier: 3,
+				Timeout:    time.Second,
+				On:         []string{"retryable", "timeout", "23505"},
+			},
+		},
+		{
+			name:   "invalid attempts",
+			yaml:   `attempts: 0`,
+			expErr: "invalid retry attempts: 0 (should be at least 1)",
+		},
+		{
+			name:   "invalid multiplier",
+			yaml:   `multiplier: 0.5`,
+			expErr: "invalid retry multiplier: 0.5 (should be at least 1)",
+		},
+		{
+			name:   "invalid jitter",
+			yaml:   `jitter: 2`,
+			expErr: "invalid retry jitter: 2 (should be between 0 and 1)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var act RetryPolicy
+			err := yaml.Unmarshal([]byte(c.yaml), &act)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{
+		Backoff:    time.Millisecond * 10,
+		MaxBackoff: time.Millisecond * 50,
+		Multiplier: 2,
+	}
+
+	assert.Equal(t, time.Millisecond*10, p.delay(1))
+	assert.Equal(t, time.Millisecond*20, p.delay(2))
+	assert.Equal(t, time.Millisecond*40, p.delay(3))
+	assert.Equal(t, time.Millisecond*50, p.delay(4))
+
+	p.Jitter = 0.5
+	for range 100 {
+		d := p.delay(1)
+		assert.GreaterOrEqual(t, d, time.Millisecond*5)
+		assert.LessOrEqual(t, d, time.Millisecond*10)
+	}
+}
+
+func TestRetryPolicyRetries(t *testing.T) {
+	serialization := fmt.Errorf("running query: %w", &pgconn.PgError{Code: "40001"})
+	duplicate := fmt.Errorf("running query: %w", &pgconn.PgError{Code: "23505"})
+
+	cases := []struct {
+		name string
+		on   []string
+		err  error
+		exp  bool
+	}{
+		{name: "category match", on: []string{"retryable"}, err: serialization, exp: true},
+		{name: "category mismatch", on: []string{"retryable"}, err: duplicate, exp: false},
+		{name: "code match", on: []string{"23505"}, err: duplicate, exp: true},
+		{name: "any", on: []string{"any"}, err: fmt.Errorf("oops"), exp: true},
+		{name: "none", on: nil, err: serialization, exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, RetryPolicy{On: c.on}.retries(c.err))
+		})
+	}
+}
+
+func TestRunRetried(t *testing.T) {
+	cases := []struct {
+		name        string
+		retry       *RetryPolicy
+		retries     int
+		errs        []error
+		expAttempts int
+		expErr      bool
+	}{
+		{
+			name:        "success",
+			retry:       &RetryPolicy{Attempts: 3, On: []string{"retryable"}},
+			errs:        []error{nil},
+			expAttempts: 1,
+		},
+		{
+			name:        "eventual success",
+			retry:       &RetryPolicy{Attempts: 3, On: []string{"retryable"}},
+			errs:        []error{&pgconn.PgError{Code: "40001"}, &pgconn.PgError{Code: "40P01"}, nil},
+			expAttempts: 3,
+		},
+		{
+			name:        "attempts exhausted",
+			retry:       &RetryPolicy{Attempts: 2, On: []string{"retryable"}},
+			errs:        []error{&pgconn.PgError{Code: "40001"}, &pgconn.PgError{Code: "40001"}, nil},
+			expAttempts: 2,
+			expErr:      true,
+		},
+		{
+			name:        "not retryable",
+			retry:       &RetryPolicy{Attempts: 3, On: []string{"retryable"}},
+			errs:        []error{&pgconn.PgError{Code: "23505"}, nil},
+			expAttempts: 1,
+			expErr:      true,
+		},
+		{
+			name:        "default policy",
+			retries:     2,
+			errs:        []error{&pgconn.PgError{Code: "23505"}, nil},
+			expAttempts: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var calls int
+
+			queryer := mockQueryer{
+				exec: func(query string, args ...any) (time.Duration, error) {
+					err := c.errs[calls]
+					calls++
+					return time.Millisecond, err
+				},
+			}
+
+			r, err := NewRunner(nil, &queryer, EnvironmentVariables{Retries: c.retries}, make(chan int, 1), &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			query := Query{Type: "exec", Query: "UPDATE t SET a = 1", Retry: c.retry}
+
+			_, taken, attempts, err := r.runRetried(context.Background(), NewVU(r), query)
+			assert.Equal(t, c.expErr, err != nil)
+			assert.Equal(t, c.expAttempts, attempts)
+			assert.Equal(t, c.expAttempts, calls)
+			assert.Equal(t, time.Millisecond*time.Duration(c.expAttempts), taken)
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/codingconcepts/drk/pkg/repo"
@@ -13,36 +16,78 @@ import (
 )
 
 const (
-	initWorkflow = "init"
+	initWorkflow     = "init"
+	teardownWorkflow = "teardown"
 )
 
 type Runner struct {
 	db          repo.Queryer
+	checkDB     repo.Queryer
+	driver      string
 	cfg         *Drk
 	envMappings envMappingGenerator
 	duration    time.Duration
 	events      chan Event
-	vuStarted   chan struct{}
+	vuCounts    chan int
 	globalArgs  globalArgs
+	templates   map[string]*queryTemplate
+	named       map[string]*namedStatement
+	retry       RetryPolicy
+	vuIDs       atomic.Int64
+	started     time.Time
 	verbose     bool
 	logger      *zerolog.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	teardownTimeout    time.Duration
+	cancelTeardown     chan struct{}
+	cancelTeardownOnce sync.Once
 }
 
-func NewRunner(cfg *Drk, db repo.Queryer, e EnvironmentVariables, vuCounts chan struct{}, logger *zerolog.Logger) (*Runner, error) {
+func NewRunner(cfg *Drk, db repo.Queryer, e EnvironmentVariables, vuCounts chan int, logger *zerolog.Logger) (*Runner, error) {
 	r := Runner{
 		db:          db,
+		driver:      e.Driver,
 		cfg:         cfg,
 		envMappings: createEnvMappingGenerator(cfg),
 		duration:    e.Duration,
 		events:      make(chan Event, 1000),
-		vuStarted:   vuCounts,
+		vuCounts:    vuCounts,
 		verbose:     e.Errors,
 		logger:      logger,
+		stop:        make(chan struct{}),
+		started:     time.Now(),
+		retry:       defaultRetryPolicy(e),
+
+		teardownTimeout: e.TeardownTimeout,
+		cancelTeardown:  make(chan struct{}),
 	}
 
 	vu := NewVU(&r)
 
 	if cfg != nil {
+		templates, err := parseQueryTemplates(cfg.Activities)
+		if err != nil {
+			return nil, fmt.Errorf("parsing query templates: %w", err)
+		}
+		r.templates = templates
+
+		if err := validateAssertions(cfg.Activities); err != nil {
+			return nil, fmt.Errorf("validating assertions: %w", err)
+		}
+
+		if err := validateMarkovWorkflows(cfg.Workflows); err != nil {
+			return nil, err
+		}
+
+		named, err := parseNamedStatements(cfg.Activities, e.Driver)
+		if err != nil {
+			return nil, fmt.Errorf("parsing named args: %w", err)
+		}
+		r.named = named
+
 		args, err := vu.generateNamedArgs(cfg.GlobalArgs)
 		if err != nil {
 			return nil, fmt.Errorf("generating global args: %w", err)
@@ -86,40 +131,228 @@ func createEnvMappingGenerator(cfg *Drk) func(env, value string) (string, bool)
 	}
 }
 
-func (r *Runner) Run() error {
+// Run runs each of the configured workflows until the test duration has
+// elapsed or the runner is stopped, followed by the teardown workflow.
+// Cancelling the context stops the runner and cancels any in-flight
+// queries, while calling Stop allows them to finish.
+func (r *Runner) Run(ctx context.Context) (err error) {
 	var eg errgroup.Group
 
+	stopOnCancel := context.AfterFunc(ctx, r.Stop)
+	defer stopOnCancel()
+
+	// Run teardown workflow however the run finishes.
+	defer func() {
+		teardownCtx, cancel := r.teardownContext(ctx)
+		defer cancel()
+
+		err = errors.Join(err, r.runTeardown(teardownCtx), r.closeTemplates())
+	}()
+
 	// Run init workflow if provided, using a single VU.
 	init, ok := r.cfg.Workflows[initWorkflow]
 	if ok {
 		r.logger.Info().Msg("running init workflow")
-		time.Sleep(time.Second)
+		r.sleep(time.Second)
 
 		init.Vus = 1
-		if err := r.runWorkflow(initWorkflow, init); err != nil {
+		if err := r.runWorkflow(ctx, initWorkflow, init); err != nil {
 			return fmt.Errorf("running init workflow: %w", err)
 		}
 	}
 	r.logger.Info().Msg("finished init workflow")
 
+	// Run checks alongside the workflows, and once more after them.
+	checksDone := make(chan struct{})
+	var checks sync.WaitGroup
+	checks.Add(1)
+	go func() {
+		defer checks.Done()
+		r.runChecks(ctx, checksDone)
+	}()
+
 	for name, workflow := range r.cfg.Workflows {
+		if name == teardownWorkflow {
+			continue
+		}
+
 		eg.Go(func() error {
-			return lo.Ternary(
-				workflow.RampFor > 0,
-				r.rampWorkflow(name, workflow),
-				r.runWorkflow(name, workflow),
-			)
+			switch {
+			case len(workflow.Stages) > 0:
+				return r.stageWorkflow(ctx, name, workflow)
+			case workflow.RampFor > 0:
+				return r.rampWorkflow(ctx, name, workflow)
+			default:
+				return r.runWorkflow(ctx, name, workflow)
+			}
 		})
 	}
 
-	return eg.Wait()
+	err = eg.Wait()
+
+	close(checksDone)
+	checks.Wait()
+
+	return err
+}
+
+// runTeardown runs the teardown workflow's setup queries once, in order,
+// using a single VU. Every query is attempted, even if those before it
+// fail, so that as much as possible is cleaned up.
+func (r *Runner) runTeardown(ctx context.Context) error {
+	teardown, ok := r.cfg.Workflows[teardownWorkflow]
+	if !ok {
+		return nil
+	}
+
+	r.logger.Info().Msg("running teardown workflow")
+
+	vu := NewVU(r)
+	vu.workflow = teardownWorkflow
+	var errs []error
+
+	for _, query := range teardown.SetupQueries {
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("cancelling teardown workflow before %q: %w", query, ctx.Err()))
+			break
+		}
+
+		act, ok := r.cfg.Activities[query]
+		if !ok {
+			errs = append(errs, fmt.Errorf("missing activity: %q", query))
+			continue
+		}
+
+		start := time.Now()
+
+		data, taken, attempts, err := r.runRetried(ctx, vu, act)
+		expected := act.ExpectErrors.match(err)
+		r.events <- Event{Workflow: "~" + teardownWorkflow, Name: query, ServiceTime: taken, ResponseTime: time.Since(start), Err: err, Expected: expected, AssertionFailed: isAssertionError(err), Attempts: attempts}
+
+		if expected {
+			continue
+		}
+
+		if err != nil {
+			r.logger.Warn().Str("query", query).Err(err).Msg("running teardown query")
+			errs = append(errs, fmt.Errorf("running teardown query %q: %w", query, err))
+			continue
+		}
+
+		if act.Type == "query" {
+			r.logger.Info().Str("query", query).Any("rows", data).Msg("teardown query")
+		}
+
+		vu.applyData(query, data)
+	}
+
+	r.logger.Info().Msg("finished teardown workflow")
+
+	return errors.Join(errs...)
+}
+
+// teardownContext returns the context to run the teardown workflow
+// with. It isn't cancelled with the run's context, as teardown should
+// run however the run finishes, but is cancelled by CancelTeardown or
+// once the teardown timeout (if any) has elapsed.
+func (r *Runner) teardownContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	parent, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	go func() {
+		select {
+		case <-r.cancelTeardown:
+			cancel()
+		case <-parent.Done():
+		}
+	}()
+
+	if r.teardownTimeout <= 0 {
+		return parent, cancel
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(parent, r.teardownTimeout)
+	return ctx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
+
+// CancelTeardown cancels the teardown workflow's in-flight queries and
+// skips those that remain. It is safe to call more than once, and
+// before the teardown workflow has started.
+func (r *Runner) CancelTeardown() {
+	r.cancelTeardownOnce.Do(func() {
+		close(r.cancelTeardown)
+	})
 }
 
 func (r *Runner) GetEventStream() <-chan Event {
 	return r.events
 }
 
-func (r *Runner) rampWorkflow(name string, workflow Workflow) error {
+// SetCheckDB sets the queryer used to run checks, allowing them to use
+// a dedicated connection. Checks use the runner's queryer otherwise.
+func (r *Runner) SetCheckDB(db repo.Queryer) {
+	r.checkDB = db
+}
+
+// Stop signals all running VUs to finish, ending the run early. It is
+// safe to call more than once.
+func (r *Runner) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// sleep waits for the given duration, returning false if the runner is
+// stopped first.
+func (r *Runner) sleep(d time.Duration) bool {
+	return wait(d, r.stop)
+}
+
+// wait waits for the given duration, returning false if the stop
+// channel is closed first.
+func wait(d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// sleepVU waits for the given duration, returning false if the runner
+// is stopped or the VU is retired (by closing its stop channel) first.
+func (r *Runner) sleepVU(d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	case <-r.stop:
+		return false
+	}
+}
+
+// retired returns true if the runner has been stopped or the VU retired.
+func (r *Runner) retired(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Runner) rampWorkflow(ctx context.Context, name string, workflow Workflow) error {
 	var eg errgroup.Group
 
 	stagger := time.Duration(0)
@@ -128,64 +361,157 @@ func (r *Runner) rampWorkflow(name string, workflow Workflow) error {
 	}
 
 	for range workflow.Vus {
-		time.Sleep(stagger)
+		if !r.sleep(stagger) {
+			break
+		}
 
 		eg.Go(func() error {
-			return r.runVU(name, workflow)
+			return r.runVU(ctx, name, workflow, nil)
 		})
 	}
 
 	return eg.Wait()
 }
 
-func (r *Runner) runWorkflow(name string, workflow Workflow) error {
+// stageWorkflow adds and retires VUs over the course of each of the
+// workflow's stages, retiring any remaining VUs once the final stage
+// has completed (or the test has run for its total duration).
+func (r *Runner) stageWorkflow(ctx context.Context, name string, workflow Workflow) error {
+	var eg errgroup.Group
+
+	// Track a stop channel for each running VU, so they can be retired
+	// in the reverse order they were started.
+	var stops []chan struct{}
+
+	deadline := time.After(r.duration)
+
+stages:
+	for _, stage := range workflow.Stages {
+		r.logger.Debug().
+			Str("workflow", name).
+			Int("from", len(stops)).
+			Int("to", stage.Vus).
+			Dur("for", stage.Duration).
+			Msg("starting stage")
+
+		steps := stage.Vus - len(stops)
+		if steps == 0 {
+			select {
+			case <-time.After(stage.Duration):
+				continue
+			case <-deadline:
+				break stages
+			case <-r.stop:
+				break stages
+			}
+		}
+
+		interval := stage.Duration / time.Duration(abs(steps))
+
+		for range abs(steps) {
+			select {
+			case <-time.After(interval):
+			case <-deadline:
+				break stages
+			case <-r.stop:
+				break stages
+			}
+
+			if steps > 0 {
+				stop := make(chan struct{})
+				stops = append(stops, stop)
+
+				eg.Go(func() error {
+					return r.runVU(ctx, name, workflow, stop)
+				})
+			} else {
+				close(stops[len(stops)-1])
+				stops = stops[:len(stops)-1]
+			}
+		}
+	}
+
+	for _, stop := range stops {
+		close(stop)
+	}
+
+	return eg.Wait()
+}
+
+func (r *Runner) runWorkflow(ctx context.Context, name string, workflow Workflow) error {
 	var eg errgroup.Group
 
 	for range workflow.Vus {
 		eg.Go(func() error {
-			return r.runVU(name, workflow)
+			return r.runVU(ctx, name, workflow, nil)
 		})
 	}
 
 	return eg.Wait()
 }
 
-func (r *Runner) runVU(workflowName string, workflow Workflow) error {
+// runVU runs a single VU for the given workflow until the workflow's
+// deadline has passed, the stop channel is closed, or the runner is
+// stopped.
+func (r *Runner) runVU(ctx context.Context, workflowName string, workflow Workflow, stop <-chan struct{}) error {
 	// Delay start if required.
 	if workflow.RunAfter > 0 {
 		r.logger.Debug().Str("workflow", workflowName).Dur("for", workflow.RunAfter).Msgf("delaying")
-		time.Sleep(workflow.RunAfter)
+		if !r.sleepVU(workflow.RunAfter, stop) {
+			return nil
+		}
 	}
 
 	// Prepare VU.
 	vu := NewVU(r)
+	vu.id = int(r.vuIDs.Add(1) - 1)
+	vu.workflow = workflowName
 
 	r.logger.Debug().Str("workflow", workflowName).Msgf("running setup queries")
 
 	for _, query := range workflow.SetupQueries {
+		// Don't start setup queries for a VU that's been retired (e.g. by
+		// a ramp-down) while running those before them.
+		if r.retired(stop) {
+			return nil
+		}
+
 		act, ok := r.cfg.Activities[query]
 		if !ok {
 			return fmt.Errorf("missing activity: %q", query)
 		}
 
-		data, taken, err := r.runQuery(vu, act)
+		start := time.Now()
+
+		data, taken, attempts, err := r.runRetried(ctx, vu, act)
 		if err != nil {
+			if cancelled(ctx, err) {
+				return nil
+			}
+
+			if act.ExpectErrors.match(err) {
+				r.events <- Event{Workflow: "*" + workflowName, Name: query, ServiceTime: taken, ResponseTime: time.Since(start), Err: err, Expected: true, Attempts: attempts}
+				continue
+			}
+
 			if r.verbose {
 				r.logger.Warn().Str("query", query).Any("error", err.Error()).Msg("running query")
 			}
 
-			r.events <- Event{Workflow: workflowName, Name: query, Duration: taken, Err: err}
+			r.events <- Event{Workflow: workflowName, Name: query, ServiceTime: taken, ResponseTime: time.Since(start), Err: err, AssertionFailed: isAssertionError(err), Attempts: attempts}
 			return fmt.Errorf("running query %q: %w", query, err)
 		}
 
-		r.events <- Event{Workflow: "*" + workflowName, Name: query, Duration: taken}
+		r.events <- Event{Workflow: "*" + workflowName, Name: query, ServiceTime: taken, ResponseTime: time.Since(start), Attempts: attempts}
 		vu.applyData(query, data)
 	}
 
 	r.logger.Debug().Str("workflow", workflowName).Msgf("finished setup queries")
 
 	// Stagger VU.
-	vu.stagger(workflow.Queries)
+	if !vu.stagger(workflow.Queries, stop) {
+		return nil
+	}
 
 	// Start VU.
 	var eg errgroup.Group
@@ -194,6 +520,18 @@ func (r *Runner) runVU(workflowName string, workflow Workflow) error {
 	deadlineDuration := lo.CoalesceOrEmpty(workflow.RunFor, r.duration)
 	deadline := time.After(deadlineDuration)
 
+	// Signal termination to all activities at once.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		select {
+		case <-deadline:
+		case <-stop:
+		case <-r.stop:
+		}
+	}()
+
 	r.logger.Debug().
 		Str("workflow", workflowName).
 		Dur("deadline", deadlineDuration).
@@ -208,13 +546,35 @@ func (r *Runner) runVU(workflowName string, workflow Workflow) error {
 		}
 
 		activities++
+
+		// Sequence and markov workflows run their queries as steps in a
+		// single loop.
+		if workflow.Mode.stepped() {
+			continue
+		}
+
+		eg.Go(func() error {
+			return r.runActivity(ctx, vu, workflowName, query, act, done)
+		})
+	}
+
+	switch workflow.Mode {
+	case WorkflowModeSequence:
+		eg.Go(func() error {
+			return r.runSequence(ctx, vu, workflowName, workflow, done)
+		})
+
+	case WorkflowModeMarkov:
 		eg.Go(func() error {
-			return r.runActivity(vu, workflowName, query.Name, act, query.Rate, deadline)
+			return r.runMarkov(ctx, vu, workflowName, workflow, done)
 		})
 	}
 
-	// Notify VU has started.
-	r.vuStarted <- struct{}{}
+	// Notify VU has started and, eventually, stopped.
+	r.vuCounts <- 1
+	defer func() {
+		r.vuCounts <- -1
+	}()
 
 	r.logger.Debug().
 		Str("workflow", workflowName).
@@ -224,58 +584,322 @@ func (r *Runner) runVU(workflowName string, workflow Workflow) error {
 	return eg.Wait()
 }
 
-func (r *Runner) runActivity(vu *VU, workflowName, queryName string, query Query, rate Rate, fin <-chan time.Time) error {
-	ticks := time.NewTicker(rate.tickerInterval).C
+func (r *Runner) runActivity(ctx context.Context, vu *VU, workflowName string, wq WorkflowQuery, query Query, fin <-chan struct{}) error {
+	if wq.Arrival.open() {
+		return r.runOpenActivity(ctx, vu, workflowName, wq, query, fin)
+	}
+
+	// Schedule executions against their intended start times, rather
+	// than dropping ticks when an execution overruns, so that slow
+	// executions are reflected in the response times of those that
+	// follow them.
+	intended := time.Now().Add(wq.Rate.tickerInterval)
+
+	timer := time.NewTimer(time.Until(intended))
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticks:
-			depencenciesMet := lo.EveryBy(query.Args, func(a Arg) bool {
-				return a.dependencyCheck(vu)
-			})
-			if !depencenciesMet {
-				r.logger.Debug().Str("workflow", workflowName).Str("query", queryName).Msg("dependencies not met")
-				continue
-			}
+		case <-timer.C:
+			r.execActivity(ctx, vu, workflowName, wq.Name, query, intended)
+
+			intended = intended.Add(wq.Rate.tickerInterval)
+			timer.Reset(time.Until(intended))
 
-			data, taken, err := r.runQuery(vu, query)
-			if err != nil {
-				if r.verbose {
-					r.logger.Warn().Str("workflow", workflowName).Str("query", queryName).Err(err).Msg("")
+		case <-fin:
+			r.logger.Debug().Str("query", wq.Name).Msg("received termination signal")
+			return nil
+		}
+	}
+}
+
+// runSequence executes a workflow's queries as ordered steps, waiting
+// for each step's think time after it executes, until the fin channel
+// is closed. If the workflow has a pacing, the next iteration won't
+// start until the pacing has elapsed since the start of the previous
+// iteration.
+func (r *Runner) runSequence(ctx context.Context, vu *VU, workflowName string, workflow Workflow, fin <-chan struct{}) error {
+	if len(workflow.Queries) == 0 {
+		return nil
+	}
+
+	for {
+		iterationStart := time.Now()
+		vu.iteration++
+
+		for _, step := range workflow.Queries {
+			query := r.cfg.Activities[step.Name]
+
+			for range max(step.Repeat, 1) {
+				select {
+				case <-fin:
+					r.logger.Debug().Str("workflow", workflowName).Msg("received termination signal")
+					return nil
+				default:
 				}
 
-				r.events <- Event{Workflow: workflowName, Name: queryName, Duration: taken, Err: err}
-				continue
+				r.execActivity(ctx, vu, workflowName, step.Name, query, time.Now())
+
+				if !wait(step.ThinkTime.next(), fin) {
+					return nil
+				}
+			}
+		}
+
+		if workflow.Pacing > 0 {
+			if !wait(time.Until(iterationStart.Add(workflow.Pacing)), fin) {
+				return nil
 			}
+		}
+	}
+}
+
+// runMarkov executes a workflow's queries as steps, starting with the
+// first and choosing each subsequent step from the weighted transitions
+// of the step before it, until a transition ends the session. Sessions
+// are restarted (subject to the workflow's pacing) until the fin
+// channel is closed, unless the workflow stops VUs when their session
+// ends.
+func (r *Runner) runMarkov(ctx context.Context, vu *VU, workflowName string, workflow Workflow, fin <-chan struct{}) error {
+	if len(workflow.Queries) == 0 {
+		return nil
+	}
+
+	steps := lo.KeyBy(workflow.Queries, func(q WorkflowQuery) string {
+		return q.Name
+	})
+
+	for {
+		sessionStart := time.Now()
+		vu.iteration++
+
+		from := markovStart
+		step := workflow.Queries[0]
+
+		for {
+			select {
+			case <-fin:
+				r.logger.Debug().Str("workflow", workflowName).Msg("received termination signal")
+				return nil
+			default:
+			}
+
+			r.events <- Event{Workflow: workflowName, Transition: &Transition{From: from, To: step.Name}}
+			r.execActivity(ctx, vu, workflowName, step.Name, r.cfg.Activities[step.Name], time.Now())
+
+			if !wait(step.ThinkTime.next(), fin) {
+				return nil
+			}
+
+			to := step.Next.next()
+			if to == markovEnd {
+				r.events <- Event{Workflow: workflowName, Transition: &Transition{From: step.Name, To: markovEnd}}
+				break
+			}
+
+			from, step = step.Name, steps[to]
+		}
+
+		if workflow.OnEnd == SessionEndStop {
+			r.logger.Debug().Str("workflow", workflowName).Msg("session ended")
+			return nil
+		}
+
+		if workflow.Pacing > 0 {
+			if !wait(time.Until(sessionStart.Add(workflow.Pacing)), fin) {
+				return nil
+			}
+		}
+	}
+}
+
+// runOpenActivity schedules executions using the workflow query's
+// arrival distribution and dispatches each one without waiting for
+// the previous execution to complete.
+func (r *Runner) runOpenActivity(ctx context.Context, vu *VU, workflowName string, wq WorkflowQuery, query Query, fin <-chan struct{}) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	intended := time.Now().Add(wq.Arrival.next(wq.Rate.tickerInterval))
+
+	timer := time.NewTimer(time.Until(intended))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			wg.Add(1)
+			go func(intended time.Time) {
+				defer wg.Done()
+				r.execActivity(ctx, vu, workflowName, wq.Name, query, intended)
+			}(intended)
 
-			r.events <- Event{Workflow: workflowName, Name: queryName, Duration: taken}
-			vu.applyData(queryName, data)
+			intended = intended.Add(wq.Arrival.next(wq.Rate.tickerInterval))
+			timer.Reset(time.Until(intended))
 
 		case <-fin:
-			r.logger.Debug().Str("query", queryName).Msg("received termination signal")
+			r.logger.Debug().Str("query", wq.Name).Msg("received termination signal")
 			return nil
 		}
 	}
 }
 
-func (r *Runner) runQuery(vu *VU, query Query) ([]map[string]any, time.Duration, error) {
+// execActivity runs a query that was scheduled to start at the
+// intended time and publishes the outcome. Queries cancelled during
+// shutdown aren't published, as they didn't fail of their own accord.
+func (r *Runner) execActivity(ctx context.Context, vu *VU, workflowName, queryName string, query Query, intended time.Time) {
+	if !query.dependenciesMet(vu) {
+		r.logger.Debug().Str("workflow", workflowName).Str("query", queryName).Msg("dependencies not met")
+		return
+	}
+
+	data, taken, attempts, err := r.runRetried(ctx, vu, query)
+	if err != nil {
+		if cancelled(ctx, err) {
+			return
+		}
+
+		expected := query.ExpectErrors.match(err)
+		if r.verbose && !expected {
+			r.logger.Warn().Str("workflow", workflowName).Str("query", queryName).Int("attempts", attempts).Err(err).Msg("")
+		}
+
+		r.events <- Event{Workflow: workflowName, Name: queryName, ServiceTime: taken, ResponseTime: time.Since(intended), Err: err, Expected: expected, AssertionFailed: isAssertionError(err), Attempts: attempts}
+		return
+	}
+
+	r.events <- Event{Workflow: workflowName, Name: queryName, ServiceTime: taken, ResponseTime: time.Since(intended), Attempts: attempts}
+	vu.applyData(queryName, data)
+}
+
+// runRetried runs a query as per its retry policy (or the runner's
+// default policy), giving each attempt its own timeout. It returns the
+// number of attempts made, and the service time of them all. Expected
+// errors and failed assertions aren't retried.
+func (r *Runner) runRetried(ctx context.Context, vu *VU, query Query) (data []map[string]any, taken time.Duration, attempts int, err error) {
+	policy := r.retry
+	if query.Retry != nil {
+		policy = *query.Retry
+	}
+
+	for attempts = 1; ; attempts++ {
+		attemptCtx, cancel := policy.attemptContext(ctx, r.retry.Timeout)
+
+		var attemptTaken time.Duration
+		data, attemptTaken, err = r.runQuery(attemptCtx, vu, query)
+		cancel()
+
+		taken += attemptTaken
+
+		if err == nil || attempts >= policy.Attempts || ctx.Err() != nil || !policy.retries(err) || query.ExpectErrors.match(err) || isAssertionError(err) {
+			return
+		}
+
+		if !wait(policy.delay(attempts), ctx.Done()) {
+			return
+		}
+	}
+}
+
+func (r *Runner) runQuery(ctx context.Context, vu *VU, query Query) ([]map[string]any, time.Duration, error) {
+	return r.runStatement(ctx, vu, r.db, query)
+}
+
+func (r *Runner) runStatement(ctx context.Context, vu *VU, db repo.Queryer, query Query) ([]map[string]any, time.Duration, error) {
 	args, err := vu.generateArgs(query.Args)
 	if err != nil {
 		return nil, 0, fmt.Errorf("generating args: %w", err)
 	}
 
-	r.logger.Debug().Str("type", query.Type).Msgf("[STMT] %s", query.Query)
+	generated := args
+
+	stmt := query.Query
+
+	// The statement prepared for a templated query's shape, if any.
+	var prepared *repo.Stmt
+
+	switch {
+	case query.Template:
+		if t, ok := r.templates[query.Query]; ok {
+			if stmt, args, err = t.render(vu, r.driver, args, namedValues(query.Args, args)); err != nil {
+				return nil, 0, fmt.Errorf("rendering query: %w", err)
+			}
+
+			// Statements are prepared on the database rather than any
+			// transaction, so that they outlive it.
+			prepared = t.prepared(r.db, stmt, r.logger)
+		}
+
+	case query.Args.named():
+		if ns, ok := r.named[namedKey(query)]; ok {
+			stmt, args = ns.stmt, ns.bind(args)
+		}
+	}
+
+	r.logger.Debug().Str("type", query.Type).Msgf("[STMT] %s", stmt)
 	r.logger.Debug().Msgf("\t[ARGS] %v", args)
 
 	switch query.Type {
 	case "query":
-		return r.db.Query(query.Query, args...)
+		var data []map[string]any
+		var taken time.Duration
+		if prepared != nil {
+			data, taken, err = db.QueryStmt(ctx, prepared, args...)
+		} else {
+			data, taken, err = db.Query(ctx, stmt, args...)
+		}
+		if err == nil && query.Assert != nil {
+			err = query.Assert.check(vu, generated, namedValues(query.Args, generated), data)
+		}
+		return data, taken, err
 
 	case "exec":
-		taken, err := r.db.Exec(query.Query, args...)
+		if prepared != nil {
+			taken, err := db.ExecStmt(ctx, prepared, args...)
+			return nil, taken, err
+		}
+
+		taken, err := db.Exec(ctx, stmt, args...)
+		return nil, taken, err
+
+	case "tx":
+		taken, err := db.Tx(ctx, query.txOptions(), func(tx repo.Queryer) error {
+			return r.runTxStatements(ctx, vu, tx, query.Statements)
+		})
 		return nil, taken, err
 
 	default:
 		return nil, 0, fmt.Errorf("unsupported query type: %q", query.Type)
 	}
 }
+
+// runTxStatements runs each statement in a transaction, making the
+// rows returned by each statement available to those that follow it.
+func (r *Runner) runTxStatements(ctx context.Context, vu *VU, tx repo.Queryer, statements []TxStatement) error {
+	for _, stmt := range statements {
+		data, _, err := r.runStatement(ctx, vu, tx, stmt.Query)
+		if err != nil {
+			return fmt.Errorf("running statement %q: %w", stmt.Name, err)
+		}
+
+		if stmt.Type == "query" {
+			vu.applyData(stmt.Name, data)
+		}
+	}
+
+	return nil
+}
+
+// cancelled returns true if an error was caused by the context being
+// cancelled.
+func cancelled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && errors.Is(err, context.Canceled)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+
+	return i
+}
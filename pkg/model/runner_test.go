@@ -1,14 +1,20 @@
 package model
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/codingconcepts/drk/pkg/repo"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestRunQuery(t *testing.T) {
@@ -96,13 +102,13 @@ func TestRunQuery(t *testing.T) {
 				exec:  c.execImpl,
 			}
 
-			noopChan := make(chan struct{}, 1)
+			noopChan := make(chan int, 1)
 
 			r, err := NewRunner(nil, &queryer, EnvironmentVariables{}, noopChan, &zerolog.Logger{})
 			assert.NoError(t, err)
 
 			vu := NewVU(r)
-			act, _, err := r.runQuery(vu, c.query)
+			act, _, err := r.runQuery(context.Background(), vu, c.query)
 
 			if c.expError != nil {
 				assert.Equal(t, c.expError, err)
@@ -173,3 +179,660 @@ func TestCreateEnvMappingGenerator(t *testing.T) {
 		})
 	}
 }
+
+func TestStageWorkflow(t *testing.T) {
+	cases := []struct {
+		name      string
+		stages    []Stage
+		expDeltas []int
+	}{
+		{
+			name: "ramp up and down",
+			stages: []Stage{
+				{Duration: time.Millisecond * 20, Vus: 2},
+				{Duration: time.Millisecond * 20, Vus: 2},
+				{Duration: time.Millisecond * 20, Vus: 0},
+			},
+			expDeltas: []int{1, 1, -1, -1},
+		},
+		{
+			name: "spike",
+			stages: []Stage{
+				{Duration: 0, Vus: 3},
+				{Duration: time.Millisecond * 20, Vus: 3},
+			},
+			expDeltas: []int{1, 1, 1, -1, -1, -1},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			queryer := mockQueryer{
+				exec: func(s string, a ...any) (time.Duration, error) {
+					return 0, nil
+				},
+			}
+
+			cfg := Drk{
+				Activities: map[string]Query{
+					"a": {Type: "exec"},
+				},
+			}
+
+			vuCounts := make(chan int, 100)
+
+			r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{Duration: time.Minute}, vuCounts, &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			workflow := Workflow{
+				Queries: []WorkflowQuery{
+					{Name: "a", Rate: Rate{tickerInterval: time.Millisecond * 10}},
+				},
+				Stages: c.stages,
+			}
+
+			assert.NoError(t, r.stageWorkflow(context.Background(), "test", workflow))
+			close(vuCounts)
+
+			var act []int
+			var running int
+			for delta := range vuCounts {
+				act = append(act, delta)
+
+				running += delta
+				assert.GreaterOrEqual(t, running, 0)
+			}
+
+			assert.ElementsMatch(t, c.expDeltas, act)
+			assert.Equal(t, 0, running)
+		})
+	}
+}
+
+func TestStageUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    Stage
+		expErr string
+	}{
+		{
+			name: "valid",
+			yaml: "{duration: 10s, vus: 5}",
+			exp:  Stage{Duration: time.Second * 10, Vus: 5},
+		},
+		{
+			name: "spike to zero",
+			yaml: "{duration: 0s, vus: 0}",
+			exp:  Stage{},
+		},
+		{
+			name:   "negative vus",
+			yaml:   "{duration: 10ms, vus: -1}",
+			expErr: "invalid stage vus: -1 (should be zero or more)",
+		},
+		{
+			name:   "negative duration",
+			yaml:   "{duration: -10ms, vus: 1}",
+			expErr: "invalid stage duration: -10ms (should be zero or more)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var act Stage
+			err := yaml.Unmarshal([]byte(c.yaml), &act)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestRunVURetired(t *testing.T) {
+	cases := []struct {
+		name        string
+		retireAfter string
+		expExecuted []string
+	}{
+		{
+			name:        "during setup queries",
+			retireAfter: "first",
+			expExecuted: []string{"first"},
+		},
+		{
+			name:        "during stagger",
+			retireAfter: "second",
+			expExecuted: []string{"first", "second"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stop := make(chan struct{})
+
+			var mu sync.Mutex
+			var executed []string
+
+			queryer := mockQueryer{
+				exec: func(s string, a ...any) (time.Duration, error) {
+					mu.Lock()
+					defer mu.Unlock()
+
+					// Retire the VU while it's running this query.
+					executed = append(executed, s)
+					if s == c.retireAfter {
+						close(stop)
+					}
+					return 0, nil
+				},
+			}
+
+			cfg := Drk{
+				Activities: map[string]Query{
+					"first":  {Type: "exec", Query: "first"},
+					"second": {Type: "exec", Query: "second"},
+					"browse": {Type: "exec", Query: "browse"},
+				},
+			}
+
+			r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{Duration: time.Hour}, make(chan int, 10), &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			// An hourly query staggers the VU's start by up to an hour.
+			workflow := Workflow{
+				SetupQueries: []string{"first", "second"},
+				Queries: []WorkflowQuery{
+					{Name: "browse", Rate: Rate{tickerInterval: time.Hour}},
+				},
+			}
+
+			finished := make(chan error)
+			go func() {
+				finished <- r.runVU(context.Background(), "test", workflow, stop)
+			}()
+
+			select {
+			case err := <-finished:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatal("retired VU didn't finish")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, c.expExecuted, executed)
+		})
+	}
+}
+
+func TestRunActivityResponseTime(t *testing.T) {
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			time.Sleep(time.Millisecond * 20)
+			return time.Millisecond * 20, nil
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	wq := WorkflowQuery{Name: "a", Rate: Rate{tickerInterval: time.Millisecond * 10}}
+
+	fin := make(chan struct{})
+	time.AfterFunc(time.Millisecond*100, func() { close(fin) })
+
+	assert.NoError(t, r.runActivity(context.Background(), NewVU(r), "test", wq, Query{Type: "exec"}, fin))
+	close(r.events)
+
+	var events []Event
+	for e := range r.events {
+		events = append(events, e)
+	}
+
+	// Executions take twice as long as the interval between them, so
+	// each should wait longer than the last before it can start.
+	assert.GreaterOrEqual(t, len(events), 2)
+
+	last := events[len(events)-1]
+	assert.Equal(t, time.Millisecond*20, last.ServiceTime)
+	assert.Greater(t, last.ResponseTime, last.ServiceTime)
+}
+
+func TestRunQueryTx(t *testing.T) {
+	var execArgs []any
+
+	queryer := mockQueryer{
+		query: func(s string, a ...any) ([]map[string]any, time.Duration, error) {
+			return []map[string]any{{"id": "a"}}, 0, nil
+		},
+		exec: func(s string, a ...any) (time.Duration, error) {
+			execArgs = a
+			return 0, nil
+		},
+	}
+	queryer.tx = func(opts repo.TxOptions, fn func(repo.Queryer) error) (time.Duration, error) {
+		assert.Equal(t, repo.TxRetrySavepoint, opts.Retry)
+		assert.Equal(t, 5, opts.MaxRetries)
+		assert.Equal(t, sql.LevelSerializable, opts.Isolation)
+
+		return 0, fn(&queryer)
+	}
+
+	var query Query
+	err := yaml.Unmarshal([]byte(`
+type: tx
+tx:
+  isolation: serializable
+  retry: savepoint
+  max_retries: 5
+statements:
+  - name: create_order
+    type: query
+    query: INSERT INTO orders DEFAULT VALUES RETURNING id
+  - name: create_order_item
+    type: exec
+    args:
+      - type: ref
+        query: create_order
+        column: id
+    query: INSERT INTO order_item (order_id) VALUES ($1)`), &query)
+	assert.NoError(t, err)
+
+	r, err := NewRunner(nil, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	vu := NewVU(r)
+	assert.True(t, query.dependenciesMet(vu))
+
+	_, _, err = r.runQuery(context.Background(), vu, query)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"a"}, execArgs)
+	assert.Equal(t, []map[string]any{{"id": "a"}}, vu.data["create_order"])
+}
+
+func TestRunQueryTemplate(t *testing.T) {
+	var execStmt string
+	var execArgs []any
+	var prepared []string
+
+	queryer := mockQueryer{
+		exec: func(query string, args ...any) (time.Duration, error) {
+			execStmt, execArgs = query, args
+			return 0, nil
+		},
+		prepare: func(query string) error {
+			prepared = append(prepared, query)
+			return nil
+		},
+	}
+
+	var query Query
+	err := yaml.Unmarshal([]byte(`
+type: exec
+template: true
+args:
+  - type: const
+    value: 3
+query: |-
+  DELETE FROM t WHERE id IN ({{ range $i, $_ := iter (arg 0) }}{{ if $i }}, {{ end }}{{ bind $i }}{{ end }})`), &query)
+	assert.NoError(t, err)
+
+	cfg := &Drk{Activities: map[string]Query{"delete": query}}
+
+	r, err := NewRunner(cfg, &queryer, EnvironmentVariables{Driver: "mysql"}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	// Executions that render the same statement share its preparation.
+	for range 3 {
+		_, _, err = r.runQuery(context.Background(), NewVU(r), query)
+		assert.NoError(t, err)
+		assert.Equal(t, "DELETE FROM t WHERE id IN (?, ?, ?)", execStmt)
+		assert.Equal(t, []any{0, 1, 2}, execArgs)
+
+		r.templates[query.Query].pending.Wait()
+	}
+	assert.Equal(t, []string{"DELETE FROM t WHERE id IN (?, ?, ?)"}, prepared)
+}
+
+func TestTxConfigUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name   string
+		yaml   string
+		exp    TxConfig
+		expErr error
+	}{
+		{
+			name: "defaults",
+			yaml: "isolation: read_committed",
+			exp: TxConfig{
+				Isolation:  Isolation(sql.LevelReadCommitted),
+				Retry:      repo.TxRetryRestart,
+				MaxRetries: defaultTxMaxRetries,
+			},
+		},
+		{
+			name: "all fields",
+			yaml: "{isolation: serializable, retry: savepoint, max_retries: 10}",
+			exp: TxConfig{
+				Isolation:  Isolation(sql.LevelSerializable),
+				Retry:      repo.TxRetrySavepoint,
+				MaxRetries: 10,
+			},
+		},
+		{
+			name:   "invalid retry strategy",
+			yaml:   "retry: invalid",
+			expErr: fmt.Errorf("invalid tx retry strategy: \"invalid\" (should be one of: restart, savepoint)"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var act TxConfig
+			err := yaml.Unmarshal([]byte(c.yaml), &act)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestRunnerStop(t *testing.T) {
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			return 0, nil
+		},
+	}
+
+	cfg := Drk{
+		Activities: map[string]Query{
+			"a": {Type: "exec"},
+		},
+	}
+
+	r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{Duration: time.Hour}, make(chan int, 10), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	workflow := Workflow{
+		Vus: 2,
+		Queries: []WorkflowQuery{
+			{Name: "a", Rate: Rate{tickerInterval: time.Millisecond * 10}},
+		},
+	}
+
+	time.AfterFunc(time.Millisecond*50, func() {
+		r.Stop()
+		r.Stop()
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- r.runWorkflow(context.Background(), "test", workflow)
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("workflow did not stop")
+	}
+}
+
+func TestExecActivityCancelled(t *testing.T) {
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			return 0, fmt.Errorf("running query: %w", context.Canceled)
+		},
+	}
+
+	r, err := NewRunner(nil, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.execActivity(ctx, NewVU(r), "test", "a", Query{Type: "exec"}, time.Now())
+	r.execActivity(context.Background(), NewVU(r), "test", "a", Query{Type: "exec"}, time.Now())
+	close(r.events)
+
+	var events []Event
+	for e := range r.events {
+		events = append(events, e)
+	}
+
+	// Only the query that wasn't cancelled by shutdown is published.
+	assert.Len(t, events, 1)
+	assert.ErrorIs(t, events[0].Err, context.Canceled)
+}
+
+func TestRunTeardown(t *testing.T) {
+	var mu sync.Mutex
+	var executed []string
+
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			executed = append(executed, s)
+			return 0, nil
+		},
+	}
+
+	cfg := Drk{
+		Workflows: map[string]Workflow{
+			"test": {
+				Vus: 1,
+				Queries: []WorkflowQuery{
+					{Name: "insert", Rate: Rate{tickerInterval: time.Millisecond * 10}},
+				},
+			},
+			teardownWorkflow: {
+				SetupQueries: []string{"missing", "truncate"},
+			},
+		},
+		Activities: map[string]Query{
+			"insert":   {Type: "exec", Query: "INSERT"},
+			"truncate": {Type: "exec", Query: "TRUNCATE"},
+		},
+	}
+
+	r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{Duration: time.Hour}, make(chan int, 10), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	// Teardown runs even if the run is stopped early.
+	time.AfterFunc(time.Millisecond*50, r.Stop)
+
+	err = r.Run(context.Background())
+	assert.EqualError(t, err, `missing activity: "missing"`)
+	close(r.events)
+
+	// Teardown runs after all other queries, despite the missing activity.
+	assert.Equal(t, "TRUNCATE", executed[len(executed)-1])
+	assert.Equal(t, 1, lo.Count(executed, "TRUNCATE"))
+
+	var teardownEvents []Event
+	for e := range r.events {
+		if e.Workflow == "~"+teardownWorkflow {
+			teardownEvents = append(teardownEvents, e)
+		}
+	}
+
+	assert.Equal(t, []Event{{Workflow: "~teardown", Name: "truncate"}}, lo.Map(teardownEvents, func(e Event, _ int) Event {
+		return Event{Workflow: e.Workflow, Name: e.Name, Err: e.Err}
+	}))
+}
+
+func TestTeardownContext(t *testing.T) {
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		expErr  error
+	}{
+		{name: "cancelled", cancel: true, expErr: context.Canceled},
+		{name: "timed out", timeout: time.Millisecond * 10, expErr: context.DeadlineExceeded},
+		{name: "cancelled before timeout", timeout: time.Hour, cancel: true, expErr: context.Canceled},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := NewRunner(nil, &mockQueryer{}, EnvironmentVariables{TeardownTimeout: c.timeout}, make(chan int, 1), &zerolog.Logger{})
+			assert.NoError(t, err)
+
+			// The teardown context outlives the run's context.
+			runCtx, cancelRun := context.WithCancel(context.Background())
+			cancelRun()
+
+			ctx, cancel := r.teardownContext(runCtx)
+			defer cancel()
+			assert.NoError(t, ctx.Err())
+
+			if c.cancel {
+				r.CancelTeardown()
+				r.CancelTeardown()
+			}
+
+			select {
+			case <-ctx.Done():
+				assert.Equal(t, c.expErr, ctx.Err())
+			case <-time.After(time.Second):
+				t.Fatal("teardown context wasn't cancelled")
+			}
+		})
+	}
+}
+
+func TestRunTeardownCancelled(t *testing.T) {
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			t.Fatalf("unexpected query: %s", s)
+			return 0, nil
+		},
+	}
+
+	cfg := Drk{
+		Workflows: map[string]Workflow{
+			teardownWorkflow: {
+				SetupQueries: []string{"truncate"},
+			},
+		},
+		Activities: map[string]Query{
+			"truncate": {Type: "exec", Query: "TRUNCATE"},
+		},
+	}
+
+	r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = r.runTeardown(ctx)
+	assert.EqualError(t, err, `cancelling teardown workflow before "truncate": context canceled`)
+}
+
+func TestRunSequence(t *testing.T) {
+	var mu sync.Mutex
+	var executed []string
+
+	queryer := mockQueryer{
+		exec: func(s string, a ...any) (time.Duration, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			executed = append(executed, s)
+			return 0, nil
+		},
+	}
+
+	cfg := Drk{
+		Activities: map[string]Query{
+			"browse":   {Type: "exec", Query: "browse"},
+			"basket":   {Type: "exec", Query: "basket"},
+			"checkout": {Type: "exec", Query: "checkout"},
+		},
+	}
+
+	r, err := NewRunner(&cfg, &queryer, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+	assert.NoError(t, err)
+
+	workflow := Workflow{
+		Mode:   WorkflowModeSequence,
+		Pacing: time.Millisecond * 50,
+		Queries: []WorkflowQuery{
+			{Name: "browse", Repeat: 2},
+			{Name: "basket", ThinkTime: ThinkTime{Min: time.Millisecond, Max: time.Millisecond * 2}},
+			{Name: "checkout"},
+		},
+	}
+
+	// Allow time for two iterations, given the pacing.
+	fin := make(chan struct{})
+	time.AfterFunc(time.Millisecond*75, func() { close(fin) })
+
+	vu := NewVU(r)
+	assert.NoError(t, r.runSequence(context.Background(), vu, "test", workflow, fin))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	iteration := []string{"browse", "browse", "basket", "checkout"}
+	assert.Equal(t, append(iteration, iteration...), executed)
+	assert.Equal(t, 2, vu.iteration)
+}
+
+func TestGlobalArgsOrder(t *testing.T) {
+	// Each arg uses the one before it, which only works if they're
+	// generated in the order they're given.
+	var cfg Drk
+	err := yaml.Unmarshal([]byte(`
+args:
+  region:
+    type: const
+    value: eu
+  zone:
+    type: expr
+    value: arg("region") + "-1"
+  cluster:
+    type: expr
+    value: arg("zone") + "a"
+  node:
+    type: expr
+    value: arg("cluster") + "-n1"
+  host:
+    type: expr
+    value: arg("node") + ".db"
+  url:
+    type: expr
+    value: '"postgres://" + arg("host")'`), &cfg)
+	assert.NoError(t, err)
+
+	for range 10 {
+		r, err := NewRunner(&cfg, &mockQueryer{}, EnvironmentVariables{}, make(chan int, 1), &zerolog.Logger{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		url, ok := r.globalArgs.get("url")
+		assert.True(t, ok)
+		assert.Equal(t, "postgres://eu-1a-n1.db", url)
+	}
+}
+
+func TestGlobalArgsUnmarshalYAMLInvalid(t *testing.T) {
+	var cfg Drk
+	err := yaml.Unmarshal([]byte(`
+args:
+  - type: const
+    value: eu`), &cfg)
+	assert.ErrorContains(t, err, "invalid global args: should be a mapping of names to args")
+}
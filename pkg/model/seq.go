@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// SeqScope determines which VUs share a seq arg's counter.
+type SeqScope string
+
+const (
+	// SeqScopeVU gives each VU its own counter.
+	SeqScopeVU SeqScope = "vu"
+
+	// SeqScopeWorkflow shares a counter between the VUs of a workflow.
+	SeqScopeWorkflow SeqScope = "workflow"
+
+	// SeqScopeGlobal shares a counter between every VU.
+	SeqScopeGlobal SeqScope = "global"
+)
+
+// sequence generates monotonically increasing values for a seq arg.
+type sequence struct {
+	start  int64
+	step   int64
+	block  int64
+	scope  SeqScope
+	format string
+
+	global    atomic.Int64
+	workflows sync.Map
+}
+
+func parseArgTypeSeq(raw map[string]any) (genFunc, dependencyFunc, error) {
+	s := sequence{
+		start: 1,
+		step:  1,
+		scope: SeqScopeGlobal,
+	}
+
+	fields := []struct {
+		name  string
+		value *int64
+	}{
+		{name: "start", value: &s.start},
+		{name: "step", value: &s.step},
+		{name: "block", value: &s.block},
+	}
+
+	for _, f := range fields {
+		v, err := parseField[int](raw, f.name)
+		if err != nil {
+			if _, ok := err.(FieldMissingErr); ok {
+				continue
+			}
+			return nil, nil, fmt.Errorf("parsing %s: %w", f.name, err)
+		}
+		*f.value = int64(v)
+	}
+
+	if s.step == 0 {
+		return nil, nil, fmt.Errorf("invalid step: 0 (should be non-zero)")
+	}
+
+	scope, err := parseField[string](raw, "scope")
+	if err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing scope: %w", err)
+		}
+	} else {
+		s.scope = SeqScope(scope)
+	}
+
+	switch s.scope {
+	case SeqScopeVU, SeqScopeWorkflow, SeqScopeGlobal:
+	default:
+		return nil, nil, fmt.Errorf("invalid scope: %q (should be one of: %s, %s, %s)", s.scope, SeqScopeVU, SeqScopeWorkflow, SeqScopeGlobal)
+	}
+
+	if s.block < 0 {
+		return nil, nil, fmt.Errorf("invalid block: %d (should be greater than 0)", s.block)
+	}
+
+	if s.block > 0 && s.scope != SeqScopeVU {
+		return nil, nil, fmt.Errorf("invalid block: only supported for %s scope", SeqScopeVU)
+	}
+
+	if s.format, err = parseField[string](raw, "format"); err != nil {
+		if _, ok := err.(FieldMissingErr); !ok {
+			return nil, nil, fmt.Errorf("parsing format: %w", err)
+		}
+	}
+
+	genFunc := func(vu *VU) (any, error) {
+		v, err := s.next(vu)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.format != "" {
+			return fmt.Sprintf(s.format, v), nil
+		}
+		return v, nil
+	}
+
+	return genFunc, dependencyFuncNoop, nil
+}
+
+// next returns the next value in the sequence for a VU. When a block
+// size is given, each VU is limited to its own range of that many
+// values, starting at (VU id * block) steps into the sequence.
+func (s *sequence) next(vu *VU) (int64, error) {
+	var n int64
+
+	switch s.scope {
+	case SeqScopeGlobal:
+		n = s.global.Add(1) - 1
+
+	case SeqScopeWorkflow:
+		counter, _ := s.workflows.LoadOrStore(vu.workflow, &atomic.Int64{})
+		n = counter.(*atomic.Int64).Add(1) - 1
+
+	case SeqScopeVU:
+		n = vu.nextSeq(s)
+	}
+
+	if s.block > 0 {
+		if n >= s.block {
+			return 0, fmt.Errorf("sequence block exhausted for vu %d (block: %d)", vu.id, s.block)
+		}
+		n += int64(vu.id) * s.block
+	}
+
+	return s.start + n*s.step, nil
+}
@@ -0,0 +1,269 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/random"
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxTemplateShapes is the number of distinct statements (or shapes)
+	// a query template prepares. Statements rendered after that are run
+	// without being prepared, and a warning is logged.
+	maxTemplateShapes = 100
+
+	// templatePrepareTimeout bounds the time taken to prepare a shape.
+	templatePrepareTimeout = time.Second * 10
+)
+
+// queryTemplate renders the statement of a query with "template: true"
+// before each execution.
+type queryTemplate struct {
+	tmpl *template.Template
+
+	// The statement prepared for each shape the template has rendered,
+	// keyed by its text, so that executions of the same shape reuse it.
+	// Statements are nil until they've been prepared (or if they
+	// couldn't be).
+	mu       sync.Mutex
+	shapes   map[string]*repo.Stmt
+	pending  sync.WaitGroup
+	warnOnce sync.Once
+}
+
+// templateData is the data available to query templates.
+type templateData struct {
+	VU        int
+	Workflow  string
+	Iteration int
+	Args      []any
+}
+
+// templateFuncs are the functions available to query templates. The
+// bind and arg functions are replaced with call-specific versions
+// before each execution.
+var templateFuncs = template.FuncMap{
+	"bind": func(any) string { return "" },
+	"arg":  func(any) (any, error) { return nil, nil },
+	"gen": func(name string) (any, error) {
+		g, ok := random.Replacements[name]
+		if !ok {
+			return nil, fmt.Errorf("missing generator: %q", name)
+		}
+		return g(), nil
+	},
+	"int": func(min, max int) int {
+		return Int(min, max+1)
+	},
+	"set": func(values ...any) (any, error) {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("set requires at least one value")
+		}
+		return values[rand.IntN(len(values))], nil
+	},
+	"iter": func(n int) []int {
+		items := make([]int, max(n, 0))
+		for i := range items {
+			items[i] = i
+		}
+		return items
+	},
+}
+
+func parseQueryTemplate(name, text string) (*queryTemplate, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+
+	return &queryTemplate{tmpl: tmpl, shapes: map[string]*repo.Stmt{}}, nil
+}
+
+// render renders the statement for a single execution, returning the
+// statement and the values bound by the template. The query's own args
+// (and, for named args, their values by name) are available to the
+// template, but are only bound if the template binds them, so that args
+// used only for rendering don't become statement args.
+func (t *queryTemplate) render(vu *VU, driver string, args []any, named map[string]any) (string, []any, error) {
+	var bound []any
+
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", nil, fmt.Errorf("cloning template: %w", err)
+	}
+
+	tmpl.Funcs(template.FuncMap{
+		"bind": func(value any) string {
+			bound = append(bound, value)
+			return placeholder(driver, len(bound))
+		},
+		"arg": func(key any) (any, error) {
+			switch k := key.(type) {
+			case int:
+				if k < 0 || k >= len(args) {
+					return nil, fmt.Errorf("missing arg: %d (query has %d)", k, len(args))
+				}
+				return args[k], nil
+
+			case string:
+				value, ok := named[k]
+				if !ok {
+					return nil, fmt.Errorf("missing arg: %q", k)
+				}
+				return value, nil
+
+			default:
+				return nil, fmt.Errorf("invalid arg key: %v (should be an index or name)", key)
+			}
+		},
+	})
+
+	data := templateData{
+		VU:        vu.id,
+		Workflow:  vu.workflow,
+		Iteration: vu.iteration,
+		Args:      args,
+	}
+
+	var sb strings.Builder
+	if err = tmpl.Execute(&sb, data); err != nil {
+		return "", nil, fmt.Errorf("rendering template: %w", err)
+	}
+
+	return sb.String(), bound, nil
+}
+
+// prepared returns the statement prepared for a rendered statement's
+// shape, or nil if it hasn't been prepared. The first time a shape is
+// rendered, it's prepared on the database in the background, so that a
+// VU within a transaction doesn't wait for a second connection, and
+// it's run unprepared until then. Once the template has rendered
+// maxTemplateShapes shapes, new ones aren't prepared.
+func (t *queryTemplate) prepared(db repo.Queryer, text string, logger *zerolog.Logger) *repo.Stmt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if stmt, ok := t.shapes[text]; ok {
+		return stmt
+	}
+
+	if len(t.shapes) >= maxTemplateShapes {
+		t.warnOnce.Do(func() {
+			logger.Warn().Str("template", t.tmpl.Name()).Int("shapes", maxTemplateShapes).Msg("template has rendered many distinct statements, running new ones unprepared (consider binding values instead of rendering them)")
+		})
+		return nil
+	}
+
+	t.shapes[text] = nil
+
+	t.pending.Add(1)
+	go func() {
+		defer t.pending.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), templatePrepareTimeout)
+		defer cancel()
+
+		stmt, err := db.Prepare(ctx, text)
+		if err != nil {
+			logger.Warn().Str("template", t.tmpl.Name()).Err(err).Msg("preparing statement, running it unprepared")
+			return
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.shapes[text] = stmt
+	}()
+
+	return nil
+}
+
+// close waits for any statements being prepared, then closes them all.
+func (t *queryTemplate) close() error {
+	t.pending.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, stmt := range t.shapes {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	t.shapes = map[string]*repo.Stmt{}
+
+	return errors.Join(errs...)
+}
+
+// placeholder returns the placeholder for the nth (1-based) arg of a
+// statement for a driver.
+func placeholder(driver string, n int) string {
+	switch driver {
+	case "mysql":
+		return "?"
+	case "oracle":
+		return fmt.Sprintf(":%d", n)
+	case "spanner":
+		return fmt.Sprintf("@p%d", n)
+	default:
+		return fmt.Sprintf("$%d", n)
+	}
+}
+
+// parseQueryTemplates parses the templates of every activity (and tx
+// statement) with "template: true", keyed by their text.
+func parseQueryTemplates(activities map[string]Query) (map[string]*queryTemplate, error) {
+	templates := map[string]*queryTemplate{}
+
+	add := func(name string, q Query) error {
+		if !q.Template {
+			return nil
+		}
+
+		t, err := parseQueryTemplate(name, q.Query)
+		if err != nil {
+			return fmt.Errorf("parsing template for %q: %w", name, err)
+		}
+
+		templates[q.Query] = t
+		return nil
+	}
+
+	for name, q := range activities {
+		if err := add(name, q); err != nil {
+			return nil, err
+		}
+
+		for _, stmt := range q.Statements {
+			if err := add(name+"."+stmt.Name, stmt.Query); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+// closeTemplates closes the statements prepared by every query
+// template.
+func (r *Runner) closeTemplates() error {
+	var errs []error
+	for _, t := range r.templates {
+		errs = append(errs, t.close())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("closing prepared statements: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTemplateRender(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		driver   string
+		args     []any
+		expStmt  string
+		expArgs  []any
+		validate func(t *testing.T, stmt string, args []any)
+		expErr   string
+	}{
+		{
+			name:    "static",
+			text:    "SELECT 1",
+			expStmt: "SELECT 1",
+		},
+		{
+			name:    "data",
+			text:    "SELECT * FROM {{ .Workflow }}_{{ .VU }} WHERE id = {{ bind (index .Args 0) }}",
+			args:    []any{"a"},
+			expStmt: "SELECT * FROM checkout_2 WHERE id = $1",
+			expArgs: []any{"a"},
+		},
+		{
+			name:    "bind pgx",
+			text:    "SELECT * FROM t WHERE a = {{ bind (arg 0) }} AND b IN ({{ range $i, $_ := iter 3 }}{{ if $i }}, {{ end }}{{ bind $i }}{{ end }})",
+			driver:  "pgx",
+			args:    []any{"a"},
+			expStmt: "SELECT * FROM t WHERE a = $1 AND b IN ($2, $3, $4)",
+			expArgs: []any{"a", 0, 1, 2},
+		},
+		{
+			name:    "bind mysql",
+			text:    "SELECT * FROM t WHERE b IN ({{ bind 1 }}, {{ bind 2 }})",
+			driver:  "mysql",
+			expStmt: "SELECT * FROM t WHERE b IN (?, ?)",
+			expArgs: []any{1, 2},
+		},
+		{
+			name:    "bind oracle",
+			text:    "SELECT * FROM t WHERE b = {{ bind 1 }}",
+			driver:  "oracle",
+			expStmt: "SELECT * FROM t WHERE b = :1",
+			expArgs: []any{1},
+		},
+		{
+			name:    "bind spanner",
+			text:    "SELECT * FROM t WHERE b = {{ bind 1 }}",
+			driver:  "spanner",
+			expStmt: "SELECT * FROM t WHERE b = @p1",
+			expArgs: []any{1},
+		},
+		{
+			name:    "arg",
+			text:    "SELECT * FROM {{ arg 0 }}",
+			args:    []any{"orders"},
+			expStmt: "SELECT * FROM orders",
+		},
+		{
+			name:    "optional clause",
+			text:    "SELECT * FROM t{{ if eq (arg 0) true }} WHERE b = {{ bind 1 }}{{ end }}",
+			args:    []any{false},
+			expStmt: "SELECT * FROM t",
+		},
+		{
+			name: "generators",
+			text: "SELECT * FROM t_{{ set \"eu\" \"us\" }} LIMIT {{ int 1 3 }}",
+			validate: func(t *testing.T, stmt string, args []any) {
+				assert.Contains(t, []string{
+					"SELECT * FROM t_eu LIMIT 1", "SELECT * FROM t_eu LIMIT 2", "SELECT * FROM t_eu LIMIT 3",
+					"SELECT * FROM t_us LIMIT 1", "SELECT * FROM t_us LIMIT 2", "SELECT * FROM t_us LIMIT 3",
+				}, stmt)
+			},
+		},
+		{
+			name:   "missing arg",
+			text:   "SELECT * FROM {{ arg 1 }}",
+			args:   []any{"orders"},
+			expErr: "missing arg: 1 (query has 1)",
+		},
+		{
+			name:   "missing generator",
+			text:   "SELECT {{ gen \"invalid\" }}",
+			expErr: "missing generator: \"invalid\"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpl, err := parseQueryTemplate(c.name, c.text)
+			assert.NoError(t, err)
+
+			vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+			vu.id = 2
+			vu.workflow = "checkout"
+
+			stmt, args, err := tmpl.render(vu, c.driver, c.args, nil)
+			if c.expErr != "" {
+				assert.ErrorContains(t, err, c.expErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			if c.validate != nil {
+				c.validate(t, stmt, args)
+				return
+			}
+
+			assert.Equal(t, c.expStmt, stmt)
+			assert.Equal(t, c.expArgs, args)
+		})
+	}
+}
+
+func TestQueryTemplatePrepared(t *testing.T) {
+	tmpl, err := parseQueryTemplate("shapes", "SELECT * FROM t WHERE id IN ({{ range $i, $_ := iter (arg 0) }}{{ if $i }}, {{ end }}{{ bind $i }}{{ end }})")
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	prepared := map[string]int{}
+	queryer := mockQueryer{
+		prepare: func(query string) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			prepared[query]++
+			return nil
+		},
+	}
+
+	vu := NewVU(&Runner{logger: &zerolog.Logger{}})
+
+	render := func(n int) string {
+		text, _, err := tmpl.render(vu, "pgx", []any{n}, nil)
+		assert.NoError(t, err)
+		return text
+	}
+
+	// A shape runs unprepared until it's been prepared in the background.
+	assert.Nil(t, tmpl.prepared(&queryer, render(1), &zerolog.Logger{}))
+	tmpl.pending.Wait()
+
+	// Each shape is then prepared once, and reused.
+	for i := range 20 {
+		text := render(i%5 + 1)
+		tmpl.prepared(&queryer, text, &zerolog.Logger{})
+		tmpl.pending.Wait()
+
+		stmt := tmpl.prepared(&queryer, text, &zerolog.Logger{})
+		if assert.NotNil(t, stmt) {
+			assert.Equal(t, text, stmt.Query)
+		}
+	}
+	assert.Len(t, prepared, 5)
+	for _, count := range prepared {
+		assert.Equal(t, 1, count)
+	}
+
+	// Shapes beyond the limit aren't prepared.
+	for i := range maxTemplateShapes + 10 {
+		tmpl.prepared(&queryer, fmt.Sprintf("SELECT %d", i), &zerolog.Logger{})
+	}
+	tmpl.pending.Wait()
+	assert.Len(t, prepared, maxTemplateShapes)
+	assert.Len(t, tmpl.shapes, maxTemplateShapes)
+	assert.Nil(t, tmpl.prepared(&queryer, fmt.Sprintf("SELECT %d", maxTemplateShapes), &zerolog.Logger{}))
+
+	// Closing the template's statements allows shapes to be prepared
+	// again.
+	assert.NoError(t, tmpl.close())
+	assert.Empty(t, tmpl.shapes)
+
+	tmpl.prepared(&queryer, "SELECT 1", &zerolog.Logger{})
+	tmpl.pending.Wait()
+	assert.NotNil(t, tmpl.prepared(&queryer, "SELECT 1", &zerolog.Logger{}))
+	assert.Equal(t, 2, prepared["SELECT 1"])
+}
+
+func TestQueryTemplatePreparedError(t *testing.T) {
+	tmpl, err := parseQueryTemplate("invalid", "SELEC {{ bind 1 }}")
+	assert.NoError(t, err)
+
+	var prepares int
+	queryer := mockQueryer{
+		prepare: func(query string) error {
+			prepares++
+			return fmt.Errorf("syntax error")
+		},
+	}
+
+	// A shape that can't be prepared is run unprepared, without being
+	// prepared again.
+	for range 3 {
+		assert.Nil(t, tmpl.prepared(&queryer, "SELEC $1", &zerolog.Logger{}))
+		tmpl.pending.Wait()
+	}
+	assert.Equal(t, 1, prepares)
+}
+
+func TestParseQueryTemplates(t *testing.T) {
+	templates, err := parseQueryTemplates(map[string]Query{
+		"plain":     {Query: "SELECT 1"},
+		"templated": {Query: "SELECT {{ int 1 2 }}", Template: true},
+		"tx": {Statements: []TxStatement{
+			{Name: "a", Query: Query{Query: "SELECT {{ bind 1 }}", Template: true}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, templates, 2)
+	assert.Contains(t, templates, "SELECT {{ int 1 2 }}")
+	assert.Contains(t, templates, "SELECT {{ bind 1 }}")
+
+	_, err = parseQueryTemplates(map[string]Query{
+		"invalid": {Query: "SELECT {{ int 1 2 ", Template: true},
+	})
+	assert.True(t, strings.HasPrefix(err.Error(), "parsing template for \"invalid\": parsing template:"))
+}
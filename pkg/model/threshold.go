@@ -0,0 +1,211 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ThresholdMetric is the statistic of a workflow query that a threshold
+// is evaluated against.
+type ThresholdMetric string
+
+const (
+	ThresholdMetricRequests          ThresholdMetric = "requests"
+	ThresholdMetricErrors            ThresholdMetric = "errors"
+	ThresholdMetricErrorRate         ThresholdMetric = "error_rate"
+	ThresholdMetricAssertionFailures ThresholdMetric = "assertion_failures"
+	ThresholdMetricRPS               ThresholdMetric = "rps"
+	ThresholdMetricMin               ThresholdMetric = "min"
+	ThresholdMetricAvg               ThresholdMetric = "avg"
+	ThresholdMetricMax               ThresholdMetric = "max"
+	ThresholdMetricPercentile        ThresholdMetric = "percentile"
+)
+
+var (
+	thresholdPattern       = regexp.MustCompile(`^\s*(\S+?)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+	thresholdTargetPattern = regexp.MustCompile(`^(.+)\.(p\d+(?:\.\d+)?|[a-z_]+)$`)
+)
+
+// Threshold is a pass/fail condition evaluated against the statistics
+// of every workflow query matching its selector, for example:
+//
+//	checkout.p99 < 250ms
+//	*.error_rate < 0.5%
+//	browse.browse_product.rps > 100
+type Threshold struct {
+	Expression string
+
+	// Selector matches a query name (e.g. "checkout") or, if it contains
+	// a ".", a "workflow.query" key (e.g. "browse.*").
+	Selector   string
+	Metric     ThresholdMetric
+	Percentile float64
+	Operator   string
+
+	// Value is expressed in the metric's unit: nanoseconds for latencies,
+	// a fraction for error rates, and a plain number otherwise.
+	Value float64
+
+	// Abort stops the run as soon as the threshold is breached, provided
+	// the run has been going for at least AbortAfter.
+	Abort      bool
+	AbortAfter time.Duration
+}
+
+func (t *Threshold) UnmarshalYAML(node *yaml.Node) error {
+	raw := struct {
+		Threshold  string        `yaml:"threshold"`
+		Abort      bool          `yaml:"abort"`
+		AbortAfter time.Duration `yaml:"abort_after"`
+	}{}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		raw.Threshold = node.Value
+
+	case yaml.MappingNode:
+		if err := node.Decode(&raw); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("invalid threshold: should be a string or mapping")
+	}
+
+	parsed, err := ParseThreshold(raw.Threshold)
+	if err != nil {
+		return err
+	}
+
+	parsed.Abort = raw.Abort
+	parsed.AbortAfter = raw.AbortAfter
+
+	*t = parsed
+	return nil
+}
+
+// ParseThreshold parses a threshold expression in the form
+// "<selector>.<metric> <operator> <value>".
+func ParseThreshold(expression string) (Threshold, error) {
+	parts := thresholdPattern.FindStringSubmatch(expression)
+	if parts == nil {
+		return Threshold{}, fmt.Errorf("invalid threshold: %q (should be in the form: <query>.<metric> <operator> <value>)", expression)
+	}
+
+	target := thresholdTargetPattern.FindStringSubmatch(parts[1])
+	if target == nil {
+		return Threshold{}, fmt.Errorf("invalid threshold target: %q (should be in the form: <query>.<metric>)", parts[1])
+	}
+
+	t := Threshold{
+		Expression: strings.TrimSpace(expression),
+		Selector:   target[1],
+		Metric:     ThresholdMetric(target[2]),
+		Operator:   parts[2],
+	}
+
+	if _, err := path.Match(t.Selector, ""); err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold selector: %q: %w", t.Selector, err)
+	}
+
+	var err error
+	if strings.HasPrefix(target[2], "p") {
+		t.Metric = ThresholdMetricPercentile
+		if t.Percentile, err = strconv.ParseFloat(strings.TrimPrefix(target[2], "p"), 64); err != nil {
+			return Threshold{}, fmt.Errorf("parsing threshold percentile: %w", err)
+		}
+
+		if t.Percentile <= 0 || t.Percentile > 100 {
+			return Threshold{}, fmt.Errorf("threshold percentile %q out of range (0 < p <= 100)", target[2])
+		}
+	}
+
+	if t.Value, err = t.parseValue(parts[3]); err != nil {
+		return Threshold{}, fmt.Errorf("parsing threshold value: %w", err)
+	}
+
+	return t, nil
+}
+
+func (t Threshold) parseValue(s string) (float64, error) {
+	switch t.Metric {
+	case ThresholdMetricMin, ThresholdMetricAvg, ThresholdMetricMax, ThresholdMetricPercentile:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		return float64(d), nil
+
+	case ThresholdMetricErrorRate:
+		if percent, ok := strings.CutSuffix(s, "%"); ok {
+			v, err := strconv.ParseFloat(percent, 64)
+			if err != nil {
+				return 0, err
+			}
+			return v / 100, nil
+		}
+		return strconv.ParseFloat(s, 64)
+
+	case ThresholdMetricRequests, ThresholdMetricErrors, ThresholdMetricAssertionFailures, ThresholdMetricRPS:
+		return strconv.ParseFloat(s, 64)
+
+	default:
+		return 0, fmt.Errorf("unsupported metric: %q", t.Metric)
+	}
+}
+
+// Matches returns true if a "workflow.query" key is selected by the
+// threshold.
+func (t Threshold) Matches(key string) bool {
+	if !strings.Contains(t.Selector, ".") {
+		_, key, _ = strings.Cut(key, ".")
+	}
+
+	ok, _ := path.Match(t.Selector, key)
+	return ok
+}
+
+// Check returns true if the actual value satisfies the threshold.
+func (t Threshold) Check(actual float64) bool {
+	switch t.Operator {
+	case "<":
+		return actual < t.Value
+	case "<=":
+		return actual <= t.Value
+	case ">":
+		return actual > t.Value
+	case ">=":
+		return actual >= t.Value
+	case "==":
+		return actual == t.Value
+	case "!=":
+		return actual != t.Value
+	default:
+		return false
+	}
+}
+
+// Format returns a human-readable representation of a value in the
+// threshold metric's unit.
+func (t Threshold) Format(v float64) string {
+	switch t.Metric {
+	case ThresholdMetricMin, ThresholdMetricAvg, ThresholdMetricMax, ThresholdMetricPercentile:
+		return time.Duration(v).String()
+	case ThresholdMetricErrorRate:
+		return fmt.Sprintf("%.2f%%", v*100)
+	case ThresholdMetricRPS:
+		return fmt.Sprintf("%.2f", v)
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+func (t Threshold) String() string {
+	return t.Expression
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseThreshold(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+		exp        Threshold
+		expErr     error
+	}{
+		{
+			name:       "percentile",
+			expression: "checkout.p99 < 250ms",
+			exp: Threshold{
+				Expression: "checkout.p99 < 250ms",
+				Selector:   "checkout",
+				Metric:     ThresholdMetricPercentile,
+				Percentile: 99,
+				Operator:   "<",
+				Value:      float64(time.Millisecond * 250),
+			},
+		},
+		{
+			name:       "fractional percentile",
+			expression: "browse.checkout.p99.9<=1s",
+			exp: Threshold{
+				Expression: "browse.checkout.p99.9<=1s",
+				Selector:   "browse.checkout",
+				Metric:     ThresholdMetricPercentile,
+				Percentile: 99.9,
+				Operator:   "<=",
+				Value:      float64(time.Second),
+			},
+		},
+		{
+			name:       "error rate percentage",
+			expression: "*.error_rate < 0.5%",
+			exp: Threshold{
+				Expression: "*.error_rate < 0.5%",
+				Selector:   "*",
+				Metric:     ThresholdMetricErrorRate,
+				Operator:   "<",
+				Value:      0.005,
+			},
+		},
+		{
+			name:       "assertion failures",
+			expression: "*.assertion_failures == 0",
+			exp: Threshold{
+				Expression: "*.assertion_failures == 0",
+				Selector:   "*",
+				Metric:     ThresholdMetricAssertionFailures,
+				Operator:   "==",
+				Value:      0,
+			},
+		},
+		{
+			name:       "throughput",
+			expression: "browse_product.rps > 100",
+			exp: Threshold{
+				Expression: "browse_product.rps > 100",
+				Selector:   "browse_product",
+				Metric:     ThresholdMetricRPS,
+				Operator:   ">",
+				Value:      100,
+			},
+		},
+		{
+			name:       "missing operator",
+			expression: "checkout.p99 250ms",
+			expErr:     fmt.Errorf("invalid threshold: %q (should be in the form: <query>.<metric> <operator> <value>)", "checkout.p99 250ms"),
+		},
+		{
+			name:       "missing metric",
+			expression: "checkout < 250ms",
+			expErr:     fmt.Errorf("invalid threshold target: %q (should be in the form: <query>.<metric>)", "checkout"),
+		},
+		{
+			name:       "unsupported metric",
+			expression: "checkout.median < 250ms",
+			expErr:     fmt.Errorf("parsing threshold value: %w", fmt.Errorf("unsupported metric: %q", "median")),
+		},
+		{
+			name:       "latency without unit",
+			expression: "checkout.max < 250",
+			expErr:     fmt.Errorf("parsing threshold value: %w", fmt.Errorf("time: missing unit in duration %q", "250")),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := ParseThreshold(c.expression)
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestThresholdUnmarshalYAML(t *testing.T) {
+	var act []Threshold
+	err := yaml.Unmarshal([]byte(`
+- checkout.p99 < 250ms
+- threshold: "*.error_rate < 1%"
+  abort: true
+  abort_after: 30s`), &act)
+	assert.NoError(t, err)
+
+	assert.Len(t, act, 2)
+	assert.False(t, act[0].Abort)
+	assert.Equal(t, "*.error_rate < 1%", act[1].String())
+	assert.True(t, act[1].Abort)
+	assert.Equal(t, time.Second*30, act[1].AbortAfter)
+}
+
+func TestThresholdMatches(t *testing.T) {
+	cases := []struct {
+		name     string
+		selector string
+		key      string
+		exp      bool
+	}{
+		{name: "query name", selector: "checkout", key: "browse.checkout", exp: true},
+		{name: "different query name", selector: "checkout", key: "browse.basket", exp: false},
+		{name: "wildcard", selector: "*", key: "browse.checkout", exp: true},
+		{name: "workflow and query", selector: "browse.checkout", key: "browse.checkout", exp: true},
+		{name: "different workflow", selector: "buy.checkout", key: "browse.checkout", exp: false},
+		{name: "workflow wildcard", selector: "browse.*", key: "browse.checkout", exp: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			threshold := Threshold{Selector: c.selector}
+			assert.Equal(t, c.exp, threshold.Matches(c.key))
+		})
+	}
+}
+
+func TestThresholdCheck(t *testing.T) {
+	cases := []struct {
+		operator string
+		actual   float64
+		exp      bool
+	}{
+		{operator: "<", actual: 9, exp: true},
+		{operator: "<", actual: 10, exp: false},
+		{operator: "<=", actual: 10, exp: true},
+		{operator: ">", actual: 10, exp: false},
+		{operator: ">=", actual: 10, exp: true},
+		{operator: "==", actual: 10, exp: true},
+		{operator: "!=", actual: 10, exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v %s 10", c.actual, c.operator), func(t *testing.T) {
+			threshold := Threshold{Operator: c.operator, Value: 10}
+			assert.Equal(t, c.exp, threshold.Check(c.actual))
+		})
+	}
+}
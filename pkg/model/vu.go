@@ -3,7 +3,6 @@ package model
 import (
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
@@ -13,10 +12,39 @@ type VU struct {
 	// Link to runner for global arg fetching.
 	r *Runner
 
-	// Map of query names to columns to rows.
-	dataMu sync.RWMutex
+	// Map of query names to columns to rows. The mutexes are pointers,
+	// so that they're shared with the VU's call-scoped copies.
+	dataMu *sync.RWMutex
 	data   map[string][]map[string]any
 
+	// Number of times each query's data has been replaced, so that ref
+	// cursors know when to reset.
+	dataVersions map[string]int
+
+	// Number of iterations the VU has started (for sequence workflows).
+	iteration int
+
+	// Identifier of the VU (unique across workflows) and the name of the
+	// workflow it's running, for seq args.
+	id       int
+	workflow string
+
+	// Counters for vu-scoped seq args.
+	seqMu *sync.Mutex
+	seqs  map[*sequence]int64
+
+	// Cursors for sequential and unique ref args.
+	cursorMu *sync.Mutex
+	cursors  map[*refSource]refCursor
+
+	// Rows bound to names for the duration of a single query call, so
+	// that args sharing a bind name read from the same row.
+	rows map[string]boundRow
+
+	// Args generated so far in a single query call, for expr args.
+	args      []any
+	namedArgs map[string]any
+
 	envMapper envMappingGenerator
 
 	logger *zerolog.Logger
@@ -24,21 +52,29 @@ type VU struct {
 
 func NewVU(r *Runner) *VU {
 	return &VU{
-		r:         r,
-		data:      map[string][]map[string]any{},
-		envMapper: r.envMappings,
-		logger:    r.logger,
+		r:            r,
+		dataMu:       &sync.RWMutex{},
+		data:         map[string][]map[string]any{},
+		dataVersions: map[string]int{},
+		seqMu:        &sync.Mutex{},
+		seqs:         map[*sequence]int64{},
+		cursorMu:     &sync.Mutex{},
+		cursors:      map[*refSource]refCursor{},
+		envMapper:    r.envMappings,
+		logger:       r.logger,
 	}
 }
 
-func (vu *VU) stagger(queries []WorkflowQuery) {
+// stagger delays the VU, returning false if the runner is stopped
+// before the delay has elapsed.
+func (vu *VU) stagger(queries []WorkflowQuery, stop <-chan struct{}) bool {
 	// Stagger using any time between now and the max query tick.
 	maxTicks := lo.MaxBy(queries, func(a, b WorkflowQuery) bool {
 		return a.Rate.tickerInterval > b.Rate.tickerInterval
 	})
 
 	staggerDuration := Interval(0, maxTicks.Rate.tickerInterval)
-	time.Sleep(staggerDuration)
+	return vu.r.sleepVU(staggerDuration, stop)
 }
 
 func (vu *VU) applyData(query string, data []map[string]any) {
@@ -46,33 +82,133 @@ func (vu *VU) applyData(query string, data []map[string]any) {
 	defer vu.dataMu.Unlock()
 
 	vu.data[query] = data
+	vu.dataVersions[query]++
+}
+
+// nextSeq returns the number of values the VU has taken from a
+// vu-scoped sequence, before incrementing it.
+func (vu *VU) nextSeq(s *sequence) int64 {
+	vu.seqMu.Lock()
+	defer vu.seqMu.Unlock()
+
+	n := vu.seqs[s]
+	vu.seqs[s] = n + 1
+	return n
+}
+
+// nextRef returns the VU's cursor for a ref arg, before incrementing
+// it. Cursors reset when their query's data version changes.
+func (vu *VU) nextRef(s *refSource, version int) int {
+	vu.cursorMu.Lock()
+	defer vu.cursorMu.Unlock()
+
+	c := vu.cursors[s]
+	if c.version != version {
+		c = refCursor{version: version}
+	}
+
+	n := c.n
+	c.n++
+	vu.cursors[s] = c
+	return n
+}
+
+// boundRow is a row selected from a source for a bind name.
+type boundRow struct {
+	source string
+	row    map[string]any
+}
+
+// forCall returns a copy of the VU for generating a single query call's
+// args, sharing its data but with its own row bindings.
+func (vu *VU) forCall() *VU {
+	call := *vu
+	call.rows = map[string]boundRow{}
+	call.args = nil
+	call.namedArgs = map[string]any{}
+	return &call
+}
+
+// arg returns an arg generated earlier in the current call, by position
+// or by name (for named query args and global args).
+func (vu *VU) arg(key any) (any, error) {
+	switch k := key.(type) {
+	case int:
+		if k < 0 || k >= len(vu.args) {
+			return nil, fmt.Errorf("missing arg: %d (%d generated so far)", k, len(vu.args))
+		}
+		return vu.args[k], nil
+
+	case string:
+		value, ok := vu.namedArgs[k]
+		if !ok {
+			return nil, fmt.Errorf("missing arg: %q", k)
+		}
+		return value, nil
+
+	default:
+		return nil, fmt.Errorf("invalid arg key: %v (should be an index or name)", key)
+	}
+}
+
+// bindRow returns the row bound to a name for the current call, picking
+// and binding a new one if the name has yet to be bound. Args without a
+// bind name always pick a new row.
+func (vu *VU) bindRow(bind, source string, pick func() (map[string]any, error)) (map[string]any, error) {
+	if bind == "" || vu.rows == nil {
+		return pick()
+	}
+
+	if bound, ok := vu.rows[bind]; ok {
+		if bound.source != source {
+			return nil, fmt.Errorf("bind %q used for different sources: %s and %s", bind, bound.source, source)
+		}
+		return bound.row, nil
+	}
+
+	row, err := pick()
+	if err != nil {
+		return nil, err
+	}
+
+	vu.rows[bind] = boundRow{source: source, row: row}
+	return row, nil
 }
 
 func (vu *VU) generateArgs(args []Arg) ([]any, error) {
 	var values []any
 
+	call := vu.forCall()
 	for _, arg := range args {
-		v, err := arg.generator(vu)
+		v, err := arg.generator(call)
 		if err != nil {
 			return nil, fmt.Errorf("generating value for arg: %w", err)
 		}
 
 		values = append(values, v)
+		call.args = values
+		if arg.name != "" {
+			call.namedArgs[arg.name] = v
+		}
 	}
 
 	return values, nil
 }
 
-func (vu *VU) generateNamedArgs(args map[string]Arg) (map[string]any, error) {
-	values := map[string]any{}
+// generateNamedArgs generates the values of named args in order, so
+// that each can use the values of those before it.
+func (vu *VU) generateNamedArgs(args GlobalArgs) (map[string]any, error) {
+	values := make(map[string]any, len(args))
 
-	for name, arg := range args {
-		v, err := arg.generator(vu)
+	call := vu.forCall()
+	for _, arg := range args {
+		v, err := arg.generator(call)
 		if err != nil {
-			return nil, fmt.Errorf("generating value for arg: %w", err)
+			return nil, fmt.Errorf("generating value for arg %q: %w", arg.name, err)
 		}
 
-		values[name] = v
+		values[arg.name] = v
+		call.namedArgs[arg.name] = v
 	}
 
 	return values, nil
@@ -61,7 +61,9 @@ func makeWeightedItems(items []weightedItem) weightedItems {
 }
 
 func (wi weightedItems) choose() any {
-	randomWeight := Int(1, wi.totalWeight)
+	// Int's upper bound is exclusive, so add one to allow every unit of
+	// the last item's weight to be chosen.
+	randomWeight := Int(1, wi.totalWeight+1)
 	for _, i := range wi.items {
 		randomWeight -= i.Weight
 		if randomWeight <= 0 {
@@ -80,3 +80,17 @@ func TestBuildWeightedItems(t *testing.T) {
 		})
 	}
 }
+
+func TestWeightedItemsChoose(t *testing.T) {
+	items, err := buildWeightedItems([]any{"a", "b"}, []int{1, 1})
+	assert.NoError(t, err)
+
+	counts := map[any]int{}
+	for range 1000 {
+		counts[items.choose()]++
+	}
+
+	assert.Greater(t, counts["a"], 0)
+	assert.Greater(t, counts["b"], 0)
+	assert.Equal(t, 1000, counts["a"]+counts["b"])
+}
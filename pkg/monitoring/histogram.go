@@ -0,0 +1,151 @@
+package monitoring
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// histogramSubBucketBits determines the precision of a histogram;
+	// values are recorded with a relative error of at most 1/2^(bits-1).
+	histogramSubBucketBits  = 11
+	histogramSubBucketCount = 1 << histogramSubBucketBits
+	histogramSubBucketHalf  = histogramSubBucketCount / 2
+
+	histogramUnit = time.Microsecond
+)
+
+// Histogram records durations into logarithmically sized buckets, in
+// the style of an HDR histogram, allowing percentiles to be calculated
+// to within 0.1% without having to store every value. Histograms can be
+// merged, allowing interval histograms to be rolled up into cumulative
+// histograms.
+type Histogram struct {
+	counts []uint64
+	total  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram returns an empty histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// Record adds a duration to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	d = max(d, 0)
+
+	i := histogramIndex(uint64(d / histogramUnit))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i-len(h.counts)+1)...)
+	}
+	h.counts[i]++
+
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+
+	h.total++
+	h.sum += d
+}
+
+// Merge adds all of the values recorded by another histogram to this one.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, len(other.counts)-len(h.counts))...)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+
+	h.total += other.total
+	h.sum += other.sum
+}
+
+// Count returns the number of values recorded.
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Min returns the smallest value recorded.
+func (h *Histogram) Min() time.Duration {
+	return h.min
+}
+
+// Max returns the largest value recorded.
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Mean returns the average of the values recorded.
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	return h.sum / time.Duration(h.total)
+}
+
+// Percentile returns the value below which the given percentage (0-100)
+// of recorded values fall.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(p / 100 * float64(h.total)))
+	target = min(max(target, 1), h.total)
+
+	var seen uint64
+	for i, c := range h.counts {
+		if seen += c; seen >= target {
+			value := time.Duration(histogramHighestEquivalent(i)) * histogramUnit
+			return min(max(value, h.min), h.max)
+		}
+	}
+
+	return h.max
+}
+
+// histogramIndex returns the index of the bucket a value is recorded in.
+// Values below the sub-bucket count are recorded exactly, while larger
+// values share buckets with values of the same magnitude.
+func histogramIndex(v uint64) int {
+	if v < histogramSubBucketCount {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - histogramSubBucketBits
+	return histogramSubBucketCount + (shift-1)*histogramSubBucketHalf + int(v>>shift) - histogramSubBucketHalf
+}
+
+// histogramHighestEquivalent returns the largest value that would be
+// recorded in the bucket at the given index.
+func histogramHighestEquivalent(i int) uint64 {
+	if i < histogramSubBucketCount {
+		return uint64(i)
+	}
+
+	offset := i - histogramSubBucketCount
+	shift := offset/histogramSubBucketHalf + 1
+	sub := uint64(offset%histogramSubBucketHalf + histogramSubBucketHalf)
+
+	return ((sub + 1) << shift) - 1
+}
@@ -0,0 +1,201 @@
+package monitoring
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// histogramRelativeError is the largest relative error of a recorded
+// value, given the histogram's precision.
+const histogramRelativeError = 1.0 / histogramSubBucketHalf
+
+func TestHistogramPercentiles(t *testing.T) {
+	cases := []struct {
+		name   string
+		values func() []time.Duration
+		exp    map[float64]time.Duration
+		expMax time.Duration
+	}{
+		{
+			name: "uniform",
+			values: func() []time.Duration {
+				values := make([]time.Duration, 100000)
+				for i := range values {
+					values[i] = time.Duration(i+1) * time.Microsecond
+				}
+				return values
+			},
+			exp: map[float64]time.Duration{
+				50:  time.Millisecond * 50,
+				99:  time.Millisecond * 99,
+				100: time.Millisecond * 100,
+			},
+			expMax: time.Millisecond * 100,
+		},
+		{
+			name: "long tail",
+			values: func() []time.Duration {
+				var values []time.Duration
+				for range 9900 {
+					values = append(values, time.Millisecond*5)
+				}
+				for range 99 {
+					values = append(values, time.Millisecond*250)
+				}
+				return append(values, time.Second*3)
+			},
+			exp: map[float64]time.Duration{
+				50:    time.Millisecond * 5,
+				99:    time.Millisecond * 5,
+				99.9:  time.Millisecond * 250,
+				99.99: time.Millisecond * 250,
+				100:   time.Second * 3,
+			},
+			expMax: time.Second * 3,
+		},
+		{
+			name: "single value",
+			values: func() []time.Duration {
+				return []time.Duration{time.Millisecond * 123}
+			},
+			exp: map[float64]time.Duration{
+				0:   time.Millisecond * 123,
+				50:  time.Millisecond * 123,
+				100: time.Millisecond * 123,
+			},
+			expMax: time.Millisecond * 123,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values := c.values()
+			rand.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+
+			h := NewHistogram()
+			for _, v := range values {
+				h.Record(v)
+			}
+
+			assert.Equal(t, uint64(len(values)), h.Count())
+			assert.Equal(t, c.expMax, h.Max())
+
+			for p, exp := range c.exp {
+				assert.InEpsilon(t, float64(exp), float64(h.Percentile(p)), histogramRelativeError, "p%g", p)
+			}
+		})
+	}
+}
+
+func TestHistogramMinMaxMean(t *testing.T) {
+	h := NewHistogram()
+	for _, v := range []time.Duration{time.Millisecond * 30, time.Millisecond * 10, time.Millisecond * 20} {
+		h.Record(v)
+	}
+
+	assert.Equal(t, time.Millisecond*10, h.Min())
+	assert.Equal(t, time.Millisecond*30, h.Max())
+	assert.Equal(t, time.Millisecond*20, h.Mean())
+
+	// Percentiles are reported as the highest value of their bucket, but
+	// never fall outside of the recorded range.
+	assert.InEpsilon(t, float64(time.Millisecond*10), float64(h.Percentile(0)), histogramRelativeError)
+	assert.GreaterOrEqual(t, h.Percentile(0), h.Min())
+	assert.Equal(t, time.Millisecond*30, h.Percentile(100))
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	h := NewHistogram()
+
+	assert.Equal(t, uint64(0), h.Count())
+	assert.Equal(t, time.Duration(0), h.Min())
+	assert.Equal(t, time.Duration(0), h.Max())
+	assert.Equal(t, time.Duration(0), h.Mean())
+	assert.Equal(t, time.Duration(0), h.Percentile(99))
+}
+
+func TestHistogramRecordNegative(t *testing.T) {
+	h := NewHistogram()
+	h.Record(-time.Second)
+
+	assert.Equal(t, uint64(1), h.Count())
+	assert.Equal(t, time.Duration(0), h.Min())
+	assert.Equal(t, time.Duration(0), h.Percentile(50))
+}
+
+func TestHistogramMerge(t *testing.T) {
+	all := NewHistogram()
+	a := NewHistogram()
+	b := NewHistogram()
+
+	for i := range 10000 {
+		v := time.Duration(rand.Int64N(int64(time.Second)))
+		all.Record(v)
+
+		if i%3 == 0 {
+			a.Record(v)
+		} else {
+			b.Record(v)
+		}
+	}
+
+	merged := NewHistogram()
+	merged.Merge(a)
+	merged.Merge(b)
+	assert.Equal(t, all, merged)
+
+	// Merging in the other order gives the same histogram.
+	reversed := NewHistogram()
+	reversed.Merge(b)
+	reversed.Merge(a)
+	assert.Equal(t, all, reversed)
+
+	// Merging nil or empty histograms changes nothing.
+	merged.Merge(nil)
+	merged.Merge(NewHistogram())
+	assert.Equal(t, all, merged)
+}
+
+func TestHistogramBucketBoundaries(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    uint64
+		expIndex int
+		expHigh  uint64
+	}{
+		{name: "zero", value: 0, expIndex: 0, expHigh: 0},
+		{name: "last exact value", value: histogramSubBucketCount - 1, expIndex: histogramSubBucketCount - 1, expHigh: histogramSubBucketCount - 1},
+		{name: "first shared bucket", value: histogramSubBucketCount, expIndex: histogramSubBucketCount, expHigh: histogramSubBucketCount + 1},
+		{name: "shares first shared bucket", value: histogramSubBucketCount + 1, expIndex: histogramSubBucketCount, expHigh: histogramSubBucketCount + 1},
+		{name: "second shared bucket", value: histogramSubBucketCount + 2, expIndex: histogramSubBucketCount + 1, expHigh: histogramSubBucketCount + 3},
+		{name: "end of magnitude", value: histogramSubBucketCount*2 - 1, expIndex: histogramSubBucketCount + histogramSubBucketHalf - 1, expHigh: histogramSubBucketCount*2 - 1},
+		{name: "start of magnitude", value: histogramSubBucketCount * 2, expIndex: histogramSubBucketCount + histogramSubBucketHalf, expHigh: histogramSubBucketCount*2 + 3},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			i := histogramIndex(c.value)
+			assert.Equal(t, c.expIndex, i)
+			assert.Equal(t, c.expHigh, histogramHighestEquivalent(i))
+		})
+	}
+}
+
+func TestHistogramBucketsContiguous(t *testing.T) {
+	// Every bucket starts where the one before it ends, and its width is
+	// within the histogram's relative error of the values in it.
+	for i := range histogramSubBucketCount * 8 {
+		high := histogramHighestEquivalent(i)
+
+		assert.Equal(t, i, histogramIndex(high), "highest value of bucket %d", i)
+		assert.Equal(t, i+1, histogramIndex(high+1), "value after bucket %d", i)
+
+		if i > 0 {
+			low := histogramHighestEquivalent(i-1) + 1
+			assert.LessOrEqual(t, float64(high-low), float64(low)*histogramRelativeError, "width of bucket %d", i)
+		}
+	}
+}
@@ -6,8 +6,9 @@ import (
 )
 
 var (
-	// MetricRequestDuration measures the latency of successful requests,
-	// grouped by workflow and query.
+	// MetricRequestDuration measures the response time of successful
+	// requests (from their intended start time), grouped by workflow
+	// and query.
 	MetricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "drk_request_duration",
 		Buckets: []float64{
@@ -29,8 +30,31 @@ var (
 			"query",
 		})
 
-	// MetricErrorDuration measures the latency of failed requests,
-	// grouped by workflow and query.
+	// MetricRequestServiceTime measures the time taken by the database
+	// to perform successful requests, grouped by workflow and query.
+	MetricRequestServiceTime = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "drk_request_service_time",
+		Buckets: []float64{
+			0.001, // 1ms
+			0.005, // 5ms
+			0.01,  // 10ms
+			0.025, // 25ms
+			0.05,  // 50ms
+			0.1,   // 100ms
+			0.25,  // 250ms
+			0.5,   // 500ms
+			1.0,   // 1s
+			2.5,   // 2.5s
+			5.0,   // 5s
+		},
+	},
+		[]string{
+			"workflow",
+			"query",
+		})
+
+	// MetricErrorDuration measures the response time of failed requests
+	// (from their intended start time), grouped by workflow and query.
 	MetricErrorDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "drk_error_duration",
 		Buckets: []float64{
@@ -63,12 +87,58 @@ var (
 		})
 
 	// MetricErrorCount is a running total of the failed requests,
-	// grouped by workflow and query.
+	// grouped by workflow, query, and the category and driver code of
+	// their errors.
 	MetricErrorCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "drk_error_count",
 	},
 		[]string{
 			"workflow",
 			"query",
+			"category",
+			"code",
+		})
+
+	// MetricExpectedErrorCount is a running total of the failed
+	// requests whose errors were expected, grouped by workflow and
+	// query.
+	MetricExpectedErrorCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drk_expected_error_count",
+	},
+		[]string{
+			"workflow",
+			"query",
+		})
+
+	// MetricAssertionFailureCount is a running total of the requests
+	// whose rows failed their activity's assertion, grouped by workflow
+	// and query.
+	MetricAssertionFailureCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drk_assertion_failure_count",
+	},
+		[]string{
+			"workflow",
+			"query",
+		})
+
+	// MetricTransitionCount is a running total of the transitions taken
+	// between the steps of markov workflows, grouped by workflow and the
+	// steps transitioned from and to.
+	MetricTransitionCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drk_transition_count",
+	},
+		[]string{
+			"workflow",
+			"from",
+			"to",
+		})
+
+	// MetricCheckViolationCount is a running total of the violations
+	// of each check's invariant, grouped by check.
+	MetricCheckViolationCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "drk_check_violation_count",
+	},
+		[]string{
+			"check",
 		})
 )
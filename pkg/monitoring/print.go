@@ -8,10 +8,8 @@ import (
 	"strings"
 	"sync/atomic"
 	"text/tabwriter"
-	"time"
 
 	"github.com/codingconcepts/drk/pkg/model"
-	"github.com/codingconcepts/ring"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 )
@@ -31,92 +29,204 @@ var (
 )
 
 type Printer struct {
-	logger *zerolog.Logger
-	mode   PrintMode
-	clear  bool
+	logger      *zerolog.Logger
+	mode        PrintMode
+	clear       bool
+	percentiles []float64
 
-	vusRunning uint64
+	vusRunning int64
 }
 
-func NewPrinter(mode PrintMode, clear bool, vuStarted chan struct{}, logger *zerolog.Logger) *Printer {
+func NewPrinter(mode PrintMode, clear bool, percentiles []float64, vuCounts chan int, logger *zerolog.Logger) *Printer {
 	p := Printer{
-		logger: logger,
-		mode:   mode,
-		clear:  clear,
+		logger:      logger,
+		mode:        mode,
+		clear:       clear,
+		percentiles: percentiles,
 	}
 
 	go func() {
-		for range vuStarted {
-			atomic.AddUint64(&p.vusRunning, 1)
+		for delta := range vuCounts {
+			atomic.AddInt64(&p.vusRunning, int64(delta))
 		}
 	}()
 
 	return &p
 }
 
-func (p *Printer) Print(counts, errors map[string]int, latencies map[string]*ring.Ring[time.Duration]) {
+func (p *Printer) Print(snapshot Snapshot) {
 	if p.clear {
 		fmt.Print("\033[H\033[2J")
 	}
 
 	switch p.mode {
 	case PrintModeLog:
-		p.PrintLine(counts, errors, latencies)
+		p.PrintLine(snapshot)
 
 	case PrintModeTable:
-		p.PrintTable(counts, errors, latencies)
+		p.PrintTable(snapshot)
 	}
 }
 
 // PrintTable clears the terminal and prints a summary of requests.
-func (p *Printer) PrintTable(counts, errors map[string]int, latencies map[string]*ring.Ring[time.Duration]) {
+func (p *Printer) PrintTable(snapshot Snapshot) {
 	w := tabwriter.NewWriter(os.Stdout, 1, 1, 3, ' ', 0)
 
 	fmt.Fprintln(w, "VUs Running")
 	fmt.Fprintf(w, "===========\n\n")
-	fmt.Fprintln(w, atomic.LoadUint64(&p.vusRunning))
+	fmt.Fprintln(w, atomic.LoadInt64(&p.vusRunning))
 
 	fmt.Fprintf(w, "\n\n")
 
 	fmt.Fprintln(w, "Setup queries")
 	fmt.Fprintf(w, "=============\n\n")
-	writeEvent(w, counts, errors, latencies, func(s string, _ int) bool {
-		return strings.HasPrefix(s, "*")
+	p.writeEvent(w, snapshot, func(s string, _ int) bool {
+		return isSetupKey(s)
 	})
 
 	fmt.Fprintf(w, "\n\n")
 
 	fmt.Fprintln(w, "Queries")
 	fmt.Fprintf(w, "=======\n\n")
-	writeEvent(w, counts, errors, latencies, func(s string, _ int) bool {
-		return !strings.HasPrefix(s, "*")
+	p.writeEvent(w, snapshot, func(s string, _ int) bool {
+		return isWorkloadKey(s)
 	})
 
+	if lo.SomeBy(snapshot.keys(), isTeardownKey) {
+		fmt.Fprintf(w, "\n\n")
+
+		fmt.Fprintln(w, "Teardown queries")
+		fmt.Fprintf(w, "================\n\n")
+		p.writeEvent(w, snapshot, func(s string, _ int) bool {
+			return isTeardownKey(s)
+		})
+	}
+
+	if len(snapshot.ErrorClasses) > 0 {
+		fmt.Fprintf(w, "\n\n")
+
+		fmt.Fprintln(w, "Errors")
+		fmt.Fprintf(w, "======\n\n")
+		p.writeErrorClasses(w, snapshot)
+	}
+
+	if transitions := NewTransitionReports(snapshot); len(transitions) > 0 {
+		fmt.Fprintf(w, "\n\n")
+
+		fmt.Fprintln(w, "Transitions")
+		fmt.Fprintf(w, "===========\n\n")
+
+		fmt.Fprintln(w, "Workflow\tFrom\tTo\tCount\tShare")
+		fmt.Fprintln(w, "--------\t----\t--\t-----\t-----")
+
+		for _, t := range transitions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.2f%%\n", t.Workflow, t.From, t.To, t.Count, t.Share*100)
+		}
+	}
+
+	if checks := NewCheckReports(snapshot); len(checks) > 0 {
+		fmt.Fprintf(w, "\n\n")
+
+		fmt.Fprintln(w, "Checks")
+		fmt.Fprintf(w, "======\n\n")
+
+		fmt.Fprintln(w, "Result\tCheck\tRuns\tErrors\tViolations\tLast violation")
+		fmt.Fprintln(w, "------\t-----\t----\t------\t----------\t--------------")
+
+		for _, c := range checks {
+			result := thresholdOutcome(c.Passed) + lo.Ternary(c.Fail, "", " (warn)")
+			last := lo.TernaryF(len(c.Samples) > 0, func() string { return c.Samples[len(c.Samples)-1].Reason }, func() string { return "" })
+
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", result, c.Name, c.Runs, c.Errors, c.Violations, last)
+		}
+	}
+
 	w.Flush()
 }
 
 // PrintLine adds new lines to the terminal containing a summary of requests.
-func (p *Printer) PrintLine(counts, errors map[string]int, latencies map[string]*ring.Ring[time.Duration]) {
-	keys := lo.Uniq(append(lo.Keys(counts), lo.Keys(errors)...))
-	sort.Strings(keys)
+func (p *Printer) PrintLine(snapshot Snapshot) {
+	keys := snapshot.keys()
 
 	f := func(s string, _ int) bool {
-		return !strings.HasPrefix(s, "*")
+		return isWorkloadKey(s)
 	}
 
 	for _, key := range lo.Filter(keys, f) {
-		latencies := latencies[key].Slice()
-		errors := errors[key]
-		counts := counts[key]
+		errors := snapshot.Errors[key]
+		counts := snapshot.Counts[key]
+		histogram := lo.CoalesceOrEmpty(snapshot.Histograms[key], NewHistogram())
 
-		p.logger.Info().
-			Uint64("vus", atomic.LoadUint64(&p.vusRunning)).
+		event := p.logger.Info().
+			Int64("vus", atomic.LoadInt64(&p.vusRunning)).
 			Str("key", key).
 			Int("counts", counts).
 			Int("errors", errors).
-			Dur("avg_latency", lo.Sum(latencies)/time.Duration(len(latencies))).
-			Msg("")
+			Int("expected", snapshot.Expected[key]).
+			Int("assertion_failures", snapshot.AssertionFailures[key]).
+			Int("retried", snapshot.Retried[key]).
+			Str("rps", fmt.Sprintf("%.2f", snapshot.Throughput(key))).
+			Dur("avg_latency", snapshot.averageLatency(key))
+
+		for _, percentile := range p.percentiles {
+			event = event.Dur(percentileName(percentile), histogram.Percentile(percentile))
+		}
+
+		event.Dur("max", histogram.Max()).Msg("")
+	}
+}
+
+// PrintThresholds prints the outcome of each threshold.
+func (p *Printer) PrintThresholds(results []ThresholdResult) {
+	switch p.mode {
+	case PrintModeLog:
+		for _, result := range results {
+			event := p.logger.Info()
+			if !result.Passed {
+				event = p.logger.Error()
+			}
+
+			event = event.
+				Str("threshold", result.Threshold.String()).
+				Bool("passed", result.Passed)
+
+			for _, value := range result.Values {
+				event = event.Str(value.Key, result.Threshold.Format(value.Actual))
+			}
+
+			event.Msg("threshold")
+		}
+
+	case PrintModeTable:
+		w := tabwriter.NewWriter(os.Stdout, 1, 1, 3, ' ', 0)
+
+		fmt.Fprintf(w, "\n\n")
+		fmt.Fprintln(w, "Thresholds")
+		fmt.Fprintf(w, "==========\n\n")
+
+		fmt.Fprintln(w, "Result\tThreshold\tValues")
+		fmt.Fprintln(w, "------\t---------\t------")
+
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", thresholdOutcome(result.Passed), result.Threshold, thresholdValues(result))
+		}
+
+		w.Flush()
+	}
+}
+
+func thresholdOutcome(passed bool) string {
+	return lo.Ternary(passed, "PASS", "FAIL")
+}
+
+func thresholdValues(result ThresholdResult) string {
+	if len(result.Values) == 0 {
+		return "no matching queries"
 	}
+
+	return strings.Join(lo.Map(result.Values, func(v ThresholdValue, _ int) string {
+		return fmt.Sprintf("%s=%s", v.Key, result.Threshold.Format(v.Actual))
+	}), ", ")
 }
 
 // PrintConfig displays the applications configuration in the terminal.
@@ -129,39 +239,100 @@ func (p *Printer) PrintConfig(cfg *model.Drk) {
 		p.logger.Info().Msgf("workflow: %s...", name)
 		p.logger.Info().Msgf("\tvus: %d", workflow.Vus)
 
+		if len(workflow.Stages) > 0 {
+			p.logger.Info().Msgf("\tstages:")
+			for _, stage := range workflow.Stages {
+				p.logger.Info().Msgf("\t\t- %d vus (%s)", stage.Vus, stage.Duration)
+			}
+		}
+
 		p.logger.Info().Msgf("\tsetup queries:")
 		for _, query := range workflow.SetupQueries {
 			p.logger.Info().Msgf("\t\t- %s", query)
 		}
 
+		switch workflow.Mode {
+		case model.WorkflowModeSequence:
+			p.logger.Info().Msgf("\tsequence steps (pacing %s):", workflow.Pacing)
+			for _, query := range workflow.Queries {
+				p.logger.Info().Msgf("\t\t- %s (x%d, think time %s)", query.Name, max(query.Repeat, 1), query.ThinkTime)
+			}
+			continue
+
+		case model.WorkflowModeMarkov:
+			p.logger.Info().Msgf("\tmarkov steps (pacing %s, on end %s):", workflow.Pacing, lo.CoalesceOrEmpty(workflow.OnEnd, model.SessionEndRestart))
+			for _, query := range workflow.Queries {
+				p.logger.Info().Msgf("\t\t- %s (think time %s, next %v)", query.Name, query.ThinkTime, query.Next.Weights)
+			}
+			continue
+		}
+
 		p.logger.Info().Msgf("\tworkflow queries:")
 		for _, query := range workflow.Queries {
-			p.logger.Info().Msgf("\t\t- %s (%s)", query.Name, query.Rate)
+			p.logger.Info().Msgf("\t\t- %s (%s %s)", query.Name, query.Rate, lo.CoalesceOrEmpty(query.Arrival, model.ArrivalConstant))
+		}
+	}
+
+	if len(cfg.Thresholds) > 0 {
+		p.logger.Info().Msgf("thresholds:")
+		for _, threshold := range cfg.Thresholds {
+			p.logger.Info().Msgf("\t- %s%s", threshold, lo.Ternary(threshold.Abort, " (abort)", ""))
 		}
 	}
 }
 
 type filter func(string, int) bool
 
-func writeEvent(w io.Writer, counts, errors map[string]int, latencies map[string]*ring.Ring[time.Duration], f filter) {
-	keys := lo.Uniq(append(lo.Keys(counts), lo.Keys(errors)...))
+func (p *Printer) writeErrorClasses(w io.Writer, snapshot Snapshot) {
+	keys := lo.Keys(snapshot.ErrorClasses)
 	sort.Strings(keys)
 
-	fmt.Fprintln(w, "Query\tRequests\tErrors\tAverage Latency")
-	fmt.Fprintln(w, "-----\t--------\t------\t---------------")
+	fmt.Fprintln(w, "Query\tCategory\tCode\tCount")
+	fmt.Fprintln(w, "-----\t--------\t----\t-----")
+
+	for _, key := range keys {
+		for _, c := range newErrorClassReports(snapshot.ErrorClasses[key]) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", trimKeyPrefix(key), c.Category, lo.CoalesceOrEmpty(c.Code, "-"), c.Count)
+		}
+	}
+}
+
+func (p *Printer) writeEvent(w io.Writer, snapshot Snapshot, f filter) {
+	keys := snapshot.keys()
+
+	headers := []string{"Query", "Requests", "Errors", "Expected", "Assertion Failures", "Retried", "Throughput (/s)", "Average Latency"}
+	for _, percentile := range p.percentiles {
+		headers = append(headers, percentileName(percentile))
+	}
+	headers = append(headers, "Max")
+
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	fmt.Fprintln(w, strings.Join(lo.Map(headers, func(h string, _ int) string {
+		return strings.Repeat("-", len(h))
+	}), "\t"))
 
 	for _, key := range lo.Filter(keys, f) {
-		latencies := latencies[key].Slice()
-		errors, hasErrors := errors[key]
-		counts, hasCount := counts[key]
+		errors, hasErrors := snapshot.Errors[key]
+		counts, hasCount := snapshot.Counts[key]
+		histogram := lo.CoalesceOrEmpty(snapshot.Histograms[key], NewHistogram())
 
 		fmt.Fprintf(
 			w,
-			"%s\t%d\t%d\t%s\n",
-			strings.TrimPrefix(key, "*"),
+			"%s\t%d\t%d\t%d\t%d\t%d\t%.2f\t%s",
+			trimKeyPrefix(key),
 			lo.Ternary(hasCount, counts, 0),
 			lo.Ternary(hasErrors, errors, 0),
-			lo.Sum(latencies)/time.Duration(len(latencies)),
+			snapshot.Expected[key],
+			snapshot.AssertionFailures[key],
+			snapshot.Retried[key],
+			snapshot.Throughput(key),
+			snapshot.averageLatency(key),
 		)
+
+		for _, percentile := range p.percentiles {
+			fmt.Fprintf(w, "\t%s", histogram.Percentile(percentile))
+		}
+
+		fmt.Fprintf(w, "\t%s\n", histogram.Max())
 	}
 }
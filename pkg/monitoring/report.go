@@ -0,0 +1,563 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/samber/lo"
+)
+
+// ReportMetadata describes the run a report was generated for.
+type ReportMetadata struct {
+	Version    string        `json:"version"`
+	Driver     string        `json:"driver"`
+	ConfigHash string        `json:"config_hash"`
+	Duration   time.Duration `json:"-"`
+	Started    time.Time     `json:"started"`
+	Finished   time.Time     `json:"finished"`
+
+	// AbortedBy is the threshold that stopped the run early, if any.
+	AbortedBy string `json:"aborted_by,omitempty"`
+}
+
+// Report is a machine-readable summary of a run.
+type Report struct {
+	ReportMetadata
+
+	DurationSeconds float64            `json:"duration_seconds"`
+	ElapsedSeconds  float64            `json:"elapsed_seconds"`
+	Passed          bool               `json:"passed"`
+	Queries         []QueryReport      `json:"queries"`
+	Transitions     []TransitionReport `json:"transitions,omitempty"`
+	Thresholds      []ThresholdReport  `json:"thresholds,omitempty"`
+	Checks          []CheckReport      `json:"checks,omitempty"`
+}
+
+// QueryReport summarises the requests made for a workflow query.
+type QueryReport struct {
+	Workflow   string         `json:"workflow"`
+	Query      string         `json:"query"`
+	Setup      bool           `json:"setup"`
+	Teardown   bool           `json:"teardown"`
+	Requests   int            `json:"requests"`
+	Errors     int            `json:"errors"`
+	Expected   int            `json:"expected"`
+	ErrorRate  float64        `json:"error_rate"`
+	Throughput float64        `json:"throughput"`
+	Latency    LatencyReport  `json:"latency_ms"`
+	ErrorTypes map[string]int `json:"error_types,omitempty"`
+
+	ErrorClasses []ErrorClassReport `json:"error_classes,omitempty"`
+
+	// Retried is the number of successful requests that needed more
+	// than one attempt, and FirstAttemptRate the proportion of all
+	// requests that succeeded on their first attempt.
+	Retried          int     `json:"retried"`
+	Retries          int     `json:"retries"`
+	FirstAttemptRate float64 `json:"first_attempt_rate"`
+
+	// AssertionFailures is the number of requests whose rows failed
+	// their activity's assertion.
+	AssertionFailures int `json:"assertion_failures"`
+}
+
+// ErrorClassReport counts the errors of a workflow query that share a
+// category and driver code.
+type ErrorClassReport struct {
+	Category string `json:"category"`
+	Code     string `json:"code,omitempty"`
+	Count    int    `json:"count"`
+}
+
+// TransitionReport counts the transitions taken between two steps of a
+// markov workflow. Share is the proportion of all transitions from the
+// From step that led to the To step.
+type TransitionReport struct {
+	Workflow string  `json:"workflow"`
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Count    int     `json:"count"`
+	Share    float64 `json:"share"`
+}
+
+// CheckReport summarises the runs of a check and the violations of its
+// invariant.
+type CheckReport struct {
+	Name       string                 `json:"name"`
+	Fail       bool                   `json:"fail"`
+	Passed     bool                   `json:"passed"`
+	Runs       int                    `json:"runs"`
+	Errors     int                    `json:"errors"`
+	Violations int                    `json:"violations"`
+	Samples    []CheckViolationReport `json:"samples,omitempty"`
+}
+
+// CheckViolationReport describes a single violation of a check's
+// invariant, along with the rows that broke it.
+type CheckViolationReport struct {
+	Time   time.Time        `json:"time"`
+	Reason string           `json:"reason"`
+	Rows   []map[string]any `json:"rows,omitempty"`
+}
+
+// ThresholdReport describes the outcome of a threshold.
+type ThresholdReport struct {
+	Threshold string                 `json:"threshold"`
+	Abort     bool                   `json:"abort"`
+	Passed    bool                   `json:"passed"`
+	Values    []ThresholdValueReport `json:"values"`
+}
+
+// ThresholdValueReport describes the value of a threshold's metric for
+// a single workflow query.
+type ThresholdValueReport struct {
+	Workflow string `json:"workflow"`
+	Query    string `json:"query"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
+
+// LatencyReport summarises the response times of a workflow query in
+// milliseconds.
+type LatencyReport struct {
+	Min         float64            `json:"min"`
+	Mean        float64            `json:"mean"`
+	Max         float64            `json:"max"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+// NewReport builds a report from a snapshot of a run's statistics and
+// the thresholds evaluated against it.
+func NewReport(meta ReportMetadata, snapshot Snapshot, percentiles []float64, thresholds []ThresholdResult) Report {
+	report := Report{
+		ReportMetadata:  meta,
+		DurationSeconds: meta.Duration.Seconds(),
+		ElapsedSeconds:  snapshot.Elapsed.Seconds(),
+		Passed:          meta.AbortedBy == "" && ThresholdsPassed(thresholds) && ChecksPassed(snapshot),
+		Transitions:     NewTransitionReports(snapshot),
+		Checks:          NewCheckReports(snapshot),
+	}
+
+	for _, result := range thresholds {
+		tr := ThresholdReport{
+			Threshold: result.Threshold.String(),
+			Abort:     result.Threshold.Abort,
+			Passed:    result.Passed,
+			Values:    []ThresholdValueReport{},
+		}
+
+		for _, value := range result.Values {
+			workflow, query, _ := strings.Cut(value.Key, ".")
+
+			tr.Values = append(tr.Values, ThresholdValueReport{
+				Workflow: workflow,
+				Query:    query,
+				Actual:   result.Threshold.Format(value.Actual),
+				Passed:   value.Passed,
+			})
+		}
+
+		report.Thresholds = append(report.Thresholds, tr)
+	}
+
+	keys := snapshot.keys()
+
+	for _, key := range keys {
+		workflow, query, _ := strings.Cut(key, ".")
+		histogram := lo.CoalesceOrEmpty(snapshot.Histograms[key], NewHistogram())
+
+		qr := QueryReport{
+			Workflow:   trimKeyPrefix(workflow),
+			Query:      query,
+			Setup:      isSetupKey(workflow),
+			Teardown:   isTeardownKey(workflow),
+			Requests:   snapshot.Counts[key],
+			Errors:     snapshot.Errors[key],
+			Expected:   snapshot.Expected[key],
+			Retried:    snapshot.Retried[key],
+			Retries:    snapshot.Retries[key],
+			Throughput: snapshot.Throughput(key),
+			Latency: LatencyReport{
+				Min:         milliseconds(histogram.Min()),
+				Mean:        milliseconds(histogram.Mean()),
+				Max:         milliseconds(histogram.Max()),
+				Percentiles: map[string]float64{},
+			},
+			ErrorTypes:   snapshot.ErrorMessages[key],
+			ErrorClasses: newErrorClassReports(snapshot.ErrorClasses[key]),
+
+			AssertionFailures: snapshot.AssertionFailures[key],
+		}
+
+		if total := snapshot.total(key); total > 0 {
+			qr.ErrorRate = float64(qr.Errors) / float64(total)
+			qr.FirstAttemptRate = float64(qr.Requests-qr.Retried) / float64(total)
+		}
+
+		for _, p := range percentiles {
+			qr.Latency.Percentiles[percentileName(p)] = milliseconds(histogram.Percentile(p))
+		}
+
+		report.Queries = append(report.Queries, qr)
+	}
+
+	return report
+}
+
+// newErrorClassReports orders the error classes of a workflow query by
+// count, then category and code.
+func newErrorClassReports(classes map[repo.ErrorClass]int) []ErrorClassReport {
+	var reports []ErrorClassReport
+
+	for class, count := range classes {
+		reports = append(reports, ErrorClassReport{
+			Category: string(class.Category),
+			Code:     class.Code,
+			Count:    count,
+		})
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Code < b.Code
+	})
+
+	return reports
+}
+
+// NewTransitionReports summarises the transitions taken between the
+// steps of markov workflows, ordered by workflow, from, and to.
+func NewTransitionReports(snapshot Snapshot) []TransitionReport {
+	var reports []TransitionReport
+
+	for workflow, transitions := range snapshot.Transitions {
+		totals := map[string]int{}
+		var workflowReports []TransitionReport
+
+		for transition, count := range transitions {
+			from, to, _ := strings.Cut(transition, " -> ")
+			totals[from] += count
+
+			workflowReports = append(workflowReports, TransitionReport{
+				Workflow: workflow,
+				From:     from,
+				To:       to,
+				Count:    count,
+			})
+		}
+
+		for i, tr := range workflowReports {
+			workflowReports[i].Share = float64(tr.Count) / float64(totals[tr.From])
+		}
+
+		reports = append(reports, workflowReports...)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Workflow != b.Workflow {
+			return a.Workflow < b.Workflow
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+
+	return reports
+}
+
+// NewCheckReports summarises the runs of each check, ordered by name.
+func NewCheckReports(snapshot Snapshot) []CheckReport {
+	names := lo.Keys(snapshot.Checks)
+	sort.Strings(names)
+
+	reports := make([]CheckReport, 0, len(names))
+	for _, name := range names {
+		check := snapshot.Checks[name]
+
+		cr := CheckReport{
+			Name:       name,
+			Fail:       check.Fail,
+			Passed:     check.Passed(),
+			Runs:       check.Runs,
+			Errors:     check.Errors,
+			Violations: check.Violations,
+		}
+
+		for _, result := range check.Samples {
+			cr.Samples = append(cr.Samples, CheckViolationReport{
+				Time:   result.Time,
+				Reason: result.Violation,
+				Rows:   result.Rows,
+			})
+		}
+
+		reports = append(reports, cr)
+	}
+
+	return reports
+}
+
+// WriteReport writes a report to the given path, in a format determined
+// by the path's extension (".json", ".md", or ".html").
+func WriteReport(path string, report Report) error {
+	var write func(io.Writer, Report) error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		write = writeReportJSON
+	case ".md", ".markdown":
+		write = writeReportMarkdown
+	case ".html", ".htm":
+		write = writeReportHTML
+	default:
+		return fmt.Errorf("unsupported report format: %q (should be one of: .json, .md, .html)", filepath.Ext(path))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating report file: %w", err)
+	}
+	defer f.Close()
+
+	if err = write(f, report); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+
+	return nil
+}
+
+func writeReportJSON(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(report)
+}
+
+func writeReportMarkdown(w io.Writer, report Report) error {
+	t, err := template.New("report").Funcs(reportFuncs).Parse(markdownReportTemplate)
+	if err != nil {
+		return fmt.Errorf("parsing template: %w", err)
+	}
+
+	return t.Execute(w, report)
+}
+
+func writeReportHTML(w io.Writer, report Report) error {
+	t, err := htmltemplate.New("report").Funcs(reportFuncs).Parse(htmlReportTemplate)
+	if err != nil {
+		return fmt.Errorf("parsing template: %w", err)
+	}
+
+	return t.Execute(w, report)
+}
+
+var reportFuncs = map[string]any{
+	"cell": func(s string) string {
+		return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+	},
+	"outcome": thresholdOutcome,
+	"ms": func(ms float64) string {
+		return fmt.Sprintf("%.2fms", ms)
+	},
+	"percent": func(f float64) string {
+		return fmt.Sprintf("%.2f%%", f*100)
+	},
+	"percentileNames": func(queries []QueryReport) []string {
+		if len(queries) == 0 {
+			return nil
+		}
+
+		names := lo.Keys(queries[0].Latency.Percentiles)
+		sort.Slice(names, func(i, j int) bool {
+			return percentileValue(names[i]) < percentileValue(names[j])
+		})
+		return names
+	},
+	"timestamp": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	"json": func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err.Error()
+		}
+		return string(b)
+	},
+}
+
+func percentileValue(name string) float64 {
+	var p float64
+	fmt.Sscanf(strings.TrimPrefix(name, "p"), "%g", &p)
+	return p
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+const markdownReportTemplate = `# drk report
+
+| Version | Driver | Config hash | Started | Finished | Duration |
+| ------- | ------ | ----------- | ------- | -------- | -------- |
+| {{ .Version }} | {{ .Driver }} | {{ .ConfigHash }} | {{ timestamp .Started }} | {{ timestamp .Finished }} | {{ printf "%.0fs" .ElapsedSeconds }} |
+
+## Queries
+{{ $percentiles := percentileNames .Queries }}
+| Workflow | Query | Requests | Errors | Expected | Assertion failures | Error rate | Retried | First attempt | Throughput (/s) | Mean |{{ range $percentiles }} {{ . }} |{{ end }} Max |
+| -------- | ----- | -------- | ------ | -------- | ------------------ | ---------- | ------- | ------------- | --------------- | ---- |{{ range $percentiles }} --- |{{ end }} --- |
+{{- range .Queries }}
+| {{ .Workflow }}{{ if .Setup }} (setup){{ end }}{{ if .Teardown }} (teardown){{ end }} | {{ .Query }} | {{ .Requests }} | {{ .Errors }} | {{ .Expected }} | {{ .AssertionFailures }} | {{ percent .ErrorRate }} | {{ .Retried }} | {{ percent .FirstAttemptRate }} | {{ printf "%.2f" .Throughput }} | {{ ms .Latency.Mean }} |{{ $q := . }}{{ range $percentiles }} {{ ms (index $q.Latency.Percentiles .) }} |{{ end }} {{ ms .Latency.Max }} |
+{{- end }}
+
+## Errors
+
+### By category
+
+| Workflow | Query | Category | Code | Count |
+| -------- | ----- | -------- | ---- | ----- |
+{{- range .Queries }}{{ $q := . }}{{ range .ErrorClasses }}
+| {{ $q.Workflow }} | {{ $q.Query }} | {{ .Category }} | {{ .Code }} | {{ .Count }} |
+{{- end }}{{ end }}
+
+### By message
+
+| Workflow | Query | Error | Count |
+| -------- | ----- | ----- | ----- |
+{{- range .Queries }}{{ $q := . }}{{ range $msg, $count := .ErrorTypes }}
+| {{ $q.Workflow }} | {{ $q.Query }} | {{ cell $msg }} | {{ $count }} |
+{{- end }}{{ end }}
+{{ if .Transitions }}
+## Transitions
+
+| Workflow | From | To | Count | Share |
+| -------- | ---- | -- | ----- | ----- |
+{{- range .Transitions }}
+| {{ .Workflow }} | {{ .From }} | {{ .To }} | {{ .Count }} | {{ percent .Share }} |
+{{- end }}
+{{ end }}
+{{- if .Checks }}
+## Checks
+
+| Result | Check | Runs | Errors | Violations |
+| ------ | ----- | ---- | ------ | ---------- |
+{{- range .Checks }}
+| {{ outcome .Passed }}{{ if not .Fail }} (warn){{ end }} | {{ .Name }} | {{ .Runs }} | {{ .Errors }} | {{ .Violations }} |
+{{- end }}
+
+### Violations
+
+| Check | Time | Reason | Rows |
+| ----- | ---- | ------ | ---- |
+{{- range .Checks }}{{ $c := . }}{{ range .Samples }}
+| {{ $c.Name }} | {{ timestamp .Time }} | {{ cell .Reason }} | {{ cell (json .Rows) }} |
+{{- end }}{{ end }}
+{{ end }}
+{{- if .Thresholds }}
+## Thresholds
+
+**Result: {{ outcome .Passed }}**{{ if .AbortedBy }} (aborted by {{ cell .AbortedBy }}){{ end }}
+
+| Result | Threshold | Values |
+| ------ | --------- | ------ |
+{{- range .Thresholds }}
+| {{ outcome .Passed }} | {{ cell .Threshold }} | {{ range $i, $v := .Values }}{{ if $i }}, {{ end }}{{ $v.Workflow }}.{{ $v.Query }}={{ $v.Actual }}{{ else }}no matching queries{{ end }} |
+{{- end }}
+{{ end -}}
+`
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>drk report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+</style>
+</head>
+<body>
+<h1>drk report</h1>
+<table>
+<tr><th>Version</th><th>Driver</th><th>Config hash</th><th>Started</th><th>Finished</th><th>Duration</th></tr>
+<tr><td>{{ .Version }}</td><td>{{ .Driver }}</td><td>{{ .ConfigHash }}</td><td>{{ timestamp .Started }}</td><td>{{ timestamp .Finished }}</td><td>{{ printf "%.0fs" .ElapsedSeconds }}</td></tr>
+</table>
+<h2>Queries</h2>
+{{ $percentiles := percentileNames .Queries }}
+<table>
+<tr><th>Workflow</th><th>Query</th><th>Requests</th><th>Errors</th><th>Expected</th><th>Assertion failures</th><th>Error rate</th><th>Retried</th><th>First attempt</th><th>Throughput (/s)</th><th>Mean</th>{{ range $percentiles }}<th>{{ . }}</th>{{ end }}<th>Max</th></tr>
+{{- range .Queries }}
+<tr><td>{{ .Workflow }}{{ if .Setup }} (setup){{ end }}{{ if .Teardown }} (teardown){{ end }}</td><td>{{ .Query }}</td><td>{{ .Requests }}</td><td>{{ .Errors }}</td><td>{{ .Expected }}</td><td>{{ .AssertionFailures }}</td><td>{{ percent .ErrorRate }}</td><td>{{ .Retried }}</td><td>{{ percent .FirstAttemptRate }}</td><td>{{ printf "%.2f" .Throughput }}</td><td>{{ ms .Latency.Mean }}</td>{{ $q := . }}{{ range $percentiles }}<td>{{ ms (index $q.Latency.Percentiles .) }}</td>{{ end }}<td>{{ ms .Latency.Max }}</td></tr>
+{{- end }}
+</table>
+<h2>Errors</h2>
+<h3>By category</h3>
+<table>
+<tr><th>Workflow</th><th>Query</th><th>Category</th><th>Code</th><th>Count</th></tr>
+{{- range .Queries }}{{ $q := . }}{{ range .ErrorClasses }}
+<tr><td>{{ $q.Workflow }}</td><td>{{ $q.Query }}</td><td>{{ .Category }}</td><td>{{ .Code }}</td><td>{{ .Count }}</td></tr>
+{{- end }}{{ end }}
+</table>
+<h3>By message</h3>
+<table>
+<tr><th>Workflow</th><th>Query</th><th>Error</th><th>Count</th></tr>
+{{- range .Queries }}{{ $q := . }}{{ range $msg, $count := .ErrorTypes }}
+<tr><td>{{ $q.Workflow }}</td><td>{{ $q.Query }}</td><td>{{ $msg }}</td><td>{{ $count }}</td></tr>
+{{- end }}{{ end }}
+</table>
+{{- if .Transitions }}
+<h2>Transitions</h2>
+<table>
+<tr><th>Workflow</th><th>From</th><th>To</th><th>Count</th><th>Share</th></tr>
+{{- range .Transitions }}
+<tr><td>{{ .Workflow }}</td><td>{{ .From }}</td><td>{{ .To }}</td><td>{{ .Count }}</td><td>{{ percent .Share }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Checks }}
+<h2>Checks</h2>
+<table>
+<tr><th>Result</th><th>Check</th><th>Runs</th><th>Errors</th><th>Violations</th></tr>
+{{- range .Checks }}
+<tr><td>{{ outcome .Passed }}{{ if not .Fail }} (warn){{ end }}</td><td>{{ .Name }}</td><td>{{ .Runs }}</td><td>{{ .Errors }}</td><td>{{ .Violations }}</td></tr>
+{{- end }}
+</table>
+<h3>Violations</h3>
+<table>
+<tr><th>Check</th><th>Time</th><th>Reason</th><th>Rows</th></tr>
+{{- range .Checks }}{{ $c := . }}{{ range .Samples }}
+<tr><td>{{ $c.Name }}</td><td>{{ timestamp .Time }}</td><td>{{ .Reason }}</td><td>{{ json .Rows }}</td></tr>
+{{- end }}{{ end }}
+</table>
+{{- end }}
+{{- if .Thresholds }}
+<h2>Thresholds</h2>
+<p><strong>Result: {{ outcome .Passed }}</strong>{{ if .AbortedBy }} (aborted by {{ .AbortedBy }}){{ end }}</p>
+<table>
+<tr><th>Result</th><th>Threshold</th><th>Values</th></tr>
+{{- range .Thresholds }}
+<tr><td>{{ outcome .Passed }}</td><td>{{ .Threshold }}</td><td>{{ range $i, $v := .Values }}{{ if $i }}, {{ end }}{{ $v.Workflow }}.{{ $v.Query }}={{ $v.Actual }}{{ else }}no matching queries{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`
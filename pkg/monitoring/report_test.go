@@ -0,0 +1,223 @@
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+var reportCheckTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// reportStats records a run with successful, failed, and expected
+// requests, markov transitions, and checks.
+func reportStats() *Stats {
+	stats := NewStats(100)
+
+	for range 8 {
+		stats.Record(model.Event{Workflow: "shop", Name: "browse", ResponseTime: time.Millisecond * 10})
+	}
+	stats.Record(model.Event{Workflow: "shop", Name: "browse", ResponseTime: time.Millisecond * 20, Attempts: 2})
+	stats.Record(model.Event{Workflow: "shop", Name: "browse", ResponseTime: time.Millisecond * 30, Err: &pgconn.PgError{Severity: "ERROR", Code: "40001", Message: "restart transaction"}})
+	stats.Record(model.Event{Workflow: "shop", Name: "checkout", ResponseTime: time.Millisecond * 5, Err: &pgconn.PgError{Code: "23505"}, Expected: true})
+	stats.Record(model.Event{Workflow: "*shop", Name: "seed", ResponseTime: time.Millisecond})
+
+	stats.Record(model.Event{Workflow: "shop", Transition: &model.Transition{From: "start", To: "browse"}})
+	stats.Record(model.Event{Workflow: "shop", Transition: &model.Transition{From: "browse", To: "checkout"}})
+	stats.Record(model.Event{Workflow: "shop", Transition: &model.Transition{From: "browse", To: "end"}})
+	stats.Record(model.Event{Workflow: "shop", Transition: &model.Transition{From: "browse", To: "end"}})
+
+	stats.Record(model.Event{Check: &model.CheckResult{Name: "orphans", Time: reportCheckTime, Fail: true}})
+	stats.Record(model.Event{Check: &model.CheckResult{Name: "balance", Time: reportCheckTime, Fail: true}})
+	stats.Record(model.Event{Check: &model.CheckResult{
+		Name:      "balance",
+		Time:      reportCheckTime.Add(time.Second),
+		Violation: `column "total" is 999 in row 0, expected 1000`,
+		Rows:      []map[string]any{{"total": "999"}},
+		Fail:      true,
+	}})
+	stats.Record(model.Event{Check: &model.CheckResult{Name: "balance", Time: reportCheckTime, Fail: true}, Err: errors.New("connection refused")})
+
+	return stats
+}
+
+func reportMetadata() ReportMetadata {
+	return ReportMetadata{
+		Version:    "v1.2.3",
+		Driver:     "pgx",
+		ConfigHash: "abc123",
+		Started:    reportCheckTime,
+		Finished:   reportCheckTime.Add(time.Minute),
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	snapshot := reportStats().Cumulative()
+
+	threshold, err := model.ParseThreshold("shop.*.errors < 5")
+	assert.NoError(t, err)
+
+	report := NewReport(reportMetadata(), snapshot, []float64{50, 99}, EvaluateThresholds([]model.Threshold{threshold}, snapshot))
+
+	// The thresholds passed, but the balance check was violated.
+	assert.False(t, report.Passed)
+
+	assert.Len(t, report.Queries, 3)
+	browse := report.Queries[1]
+	assert.Equal(t, "shop", browse.Workflow)
+	assert.Equal(t, "browse", browse.Query)
+	assert.Equal(t, 9, browse.Requests)
+	assert.Equal(t, 1, browse.Errors)
+	assert.Equal(t, 0.1, browse.ErrorRate)
+	assert.Equal(t, 1, browse.Retried)
+	assert.Equal(t, 0.8, browse.FirstAttemptRate)
+	assert.Equal(t, []ErrorClassReport{{Category: "retryable", Code: "40001", Count: 1}}, browse.ErrorClasses)
+	assert.Equal(t, map[string]int{"ERROR: restart transaction (SQLSTATE 40001)": 1}, browse.ErrorTypes)
+	assert.ElementsMatch(t, []string{"p50", "p99"}, lo.Keys(browse.Latency.Percentiles))
+
+	seed := report.Queries[0]
+	assert.Equal(t, "shop", seed.Workflow)
+	assert.True(t, seed.Setup)
+
+	assert.Equal(t, []TransitionReport{
+		{Workflow: "shop", From: "browse", To: "checkout", Count: 1, Share: 1.0 / 3.0},
+		{Workflow: "shop", From: "browse", To: "end", Count: 2, Share: 2.0 / 3.0},
+		{Workflow: "shop", From: "start", To: "browse", Count: 1, Share: 1},
+	}, report.Transitions)
+
+	assert.Equal(t, []CheckReport{
+		{
+			Name:       "balance",
+			Fail:       true,
+			Passed:     false,
+			Runs:       3,
+			Errors:     1,
+			Violations: 1,
+			Samples: []CheckViolationReport{
+				{
+					Time:   reportCheckTime.Add(time.Second),
+					Reason: `column "total" is 999 in row 0, expected 1000`,
+					Rows:   []map[string]any{{"total": "999"}},
+				},
+			},
+		},
+		{Name: "orphans", Fail: true, Passed: true, Runs: 1},
+	}, report.Checks)
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	snapshot := reportStats().Cumulative()
+	report := NewReport(reportMetadata(), snapshot, []float64{99}, nil)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeReportJSON(&buf, report))
+
+	// The report survives a round trip (its metadata has no Duration,
+	// which is only written in seconds).
+	var act Report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &act))
+	assert.Equal(t, report, act)
+
+	// Check the field names that CI pipelines depend on.
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+
+	for _, field := range []string{"version", "driver", "config_hash", "started", "finished", "duration_seconds", "elapsed_seconds", "passed", "queries", "transitions", "checks"} {
+		assert.Contains(t, fields, field)
+	}
+	assert.NotContains(t, fields, "thresholds")
+
+	query := fields["queries"].([]any)[1].(map[string]any)
+	for _, field := range []string{"workflow", "query", "setup", "teardown", "requests", "errors", "expected", "error_rate", "throughput", "latency_ms", "error_types", "error_classes", "retried", "retries", "first_attempt_rate", "assertion_failures"} {
+		assert.Contains(t, query, field)
+	}
+
+	check := fields["checks"].([]any)[0].(map[string]any)
+	for _, field := range []string{"name", "fail", "passed", "runs", "errors", "violations", "samples"} {
+		assert.Contains(t, check, field)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	snapshot := reportStats().Cumulative()
+
+	threshold, err := model.ParseThreshold("shop.*.errors < 5")
+	assert.NoError(t, err)
+
+	report := NewReport(reportMetadata(), snapshot, []float64{99}, EvaluateThresholds([]model.Threshold{threshold}, snapshot))
+
+	cases := []struct {
+		name        string
+		file        string
+		expContains []string
+	}{
+		{
+			name: "markdown",
+			file: "report.md",
+			expContains: []string{
+				"# drk report",
+				"| v1.2.3 | pgx | abc123 |",
+				"| shop (setup) | seed |",
+				"| shop | browse | retryable | 40001 | 1 |",
+				"| shop | browse | ERROR: restart transaction (SQLSTATE 40001) | 1 |",
+				"## Transitions",
+				"| shop | browse | end | 2 | 66.67% |",
+				"## Checks",
+				"| FAIL | balance | 3 | 1 | 1 |",
+				"| PASS | orphans | 1 | 0 | 0 |",
+				`| balance | 2024-01-02T03:04:06Z | column "total" is 999 in row 0, expected 1000 | [{"total":"999"}] |`,
+				"## Thresholds",
+				"**Result: FAIL**",
+			},
+		},
+		{
+			name: "html",
+			file: "report.html",
+			expContains: []string{
+				"<h1>drk report</h1>",
+				"<td>shop (setup)</td><td>seed</td>",
+				"<td>retryable</td><td>40001</td>",
+				"<h2>Transitions</h2>",
+				"<h2>Checks</h2>",
+				"<tr><td>FAIL</td><td>balance</td><td>3</td><td>1</td><td>1</td></tr>",
+				"<td>column &#34;total&#34; is 999 in row 0, expected 1000</td>",
+				"<h2>Thresholds</h2>",
+			},
+		},
+		{
+			name: "json",
+			file: "report.json",
+			expContains: []string{
+				`"config_hash": "abc123"`,
+				`"reason": "column \"total\" is 999 in row 0, expected 1000"`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), c.file)
+			assert.NoError(t, WriteReport(path, report))
+
+			b, err := os.ReadFile(path)
+			assert.NoError(t, err)
+
+			for _, exp := range c.expContains {
+				assert.Contains(t, string(b), exp)
+			}
+		})
+	}
+}
+
+func TestWriteReportUnsupportedFormat(t *testing.T) {
+	err := WriteReport(filepath.Join(t.TempDir(), "report.txt"), Report{})
+	assert.EqualError(t, err, `unsupported report format: ".txt" (should be one of: .json, .md, .html)`)
+}
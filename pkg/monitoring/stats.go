@@ -0,0 +1,414 @@
+package monitoring
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/codingconcepts/drk/pkg/repo"
+	"github.com/codingconcepts/ring"
+	"github.com/samber/lo"
+)
+
+const (
+	maxErrorMessages   = 50
+	otherErrorMessages = "(other)"
+
+	// maxCheckViolations bounds the violations recorded for each check.
+	maxCheckViolations = 20
+)
+
+// Stats aggregates the events published during a run, keyed by
+// "workflow.query".
+type Stats struct {
+	windowSize int
+	start      time.Time
+
+	counts        map[string]int
+	errors        map[string]int
+	expected      map[string]int
+	assertions    map[string]int
+	errorMessages map[string]map[string]int
+	errorClasses  map[string]map[repo.ErrorClass]int
+	retried       map[string]int
+	retries       map[string]int
+	latencies     map[string]*ring.Ring[time.Duration]
+	cumulative    map[string]*Histogram
+	transitions   map[string]map[string]int
+	checks        map[string]*CheckStats
+
+	intervalStart time.Time
+	interval      map[string]*Histogram
+}
+
+// Snapshot is a point-in-time view of a run's statistics.
+type Snapshot struct {
+	Counts        map[string]int
+	Errors        map[string]int
+	ErrorMessages map[string]map[string]int
+	Latencies     map[string]*ring.Ring[time.Duration]
+
+	// ErrorClasses counts the errors of each key by their driver code
+	// and category.
+	ErrorClasses map[string]map[repo.ErrorClass]int
+
+	// Expected counts the errors of each key that the activity was
+	// expected to encounter, which aren't included in Errors.
+	Expected map[string]int
+
+	// AssertionFailures counts the requests of each key whose rows
+	// failed their activity's assertion, which aren't included in
+	// Errors.
+	AssertionFailures map[string]int
+
+	// Retried counts the requests of each key that succeeded after
+	// being retried (successes not in Retried succeeded on their first
+	// attempt), while Retries counts the retries made by all requests.
+	Retried map[string]int
+	Retries map[string]int
+
+	// Transitions counts the transitions taken between the steps of
+	// markov workflows, keyed by workflow and then "from -> to".
+	Transitions map[string]map[string]int
+
+	// Checks summarises the runs of each check, keyed by name.
+	Checks map[string]*CheckStats
+
+	// Histograms hold the response times of the successful requests
+	// made over the Elapsed period.
+	Histograms map[string]*Histogram
+	Elapsed    time.Duration
+}
+
+// NewStats returns an empty Stats that averages latencies over the
+// given number of events.
+func NewStats(windowSize int) *Stats {
+	now := time.Now()
+
+	return &Stats{
+		windowSize:    windowSize,
+		start:         now,
+		counts:        map[string]int{},
+		errors:        map[string]int{},
+		expected:      map[string]int{},
+		assertions:    map[string]int{},
+		errorMessages: map[string]map[string]int{},
+		errorClasses:  map[string]map[repo.ErrorClass]int{},
+		retried:       map[string]int{},
+		retries:       map[string]int{},
+		latencies:     map[string]*ring.Ring[time.Duration]{},
+		cumulative:    map[string]*Histogram{},
+		transitions:   map[string]map[string]int{},
+		checks:        map[string]*CheckStats{},
+		intervalStart: now,
+		interval:      map[string]*Histogram{},
+	}
+}
+
+// Record adds an event to the statistics.
+func (s *Stats) Record(event model.Event) {
+	if event.Transition != nil {
+		s.recordTransition(event.Workflow, *event.Transition)
+		return
+	}
+
+	if event.Check != nil {
+		s.recordCheck(*event.Check, event.Err)
+		return
+	}
+
+	key := fmt.Sprintf("%s.%s", event.Workflow, event.Name)
+
+	switch {
+	case event.Expected:
+		s.expected[key]++
+	case event.AssertionFailed:
+		s.assertions[key]++
+		s.recordErrorMessage(key, event.Err.Error())
+	case event.Err != nil:
+		s.errors[key]++
+		s.recordErrorMessage(key, event.Err.Error())
+		s.recordErrorClass(key, repo.Classify(event.Err))
+	default:
+		s.counts[key]++
+	}
+
+	if event.Attempts > 1 {
+		s.retries[key] += event.Attempts - 1
+		if event.Err == nil {
+			s.retried[key]++
+		}
+	}
+
+	// Only successful requests contribute to latencies and throughput, so
+	// that fast failures (e.g. refused connections) can't make a failing
+	// run look healthy.
+	if event.Err != nil {
+		return
+	}
+
+	if _, ok := s.latencies[key]; !ok {
+		s.latencies[key] = ring.New[time.Duration](s.windowSize)
+	}
+	s.latencies[key].Add(event.ResponseTime)
+
+	if _, ok := s.interval[key]; !ok {
+		s.interval[key] = NewHistogram()
+	}
+	s.interval[key].Record(event.ResponseTime)
+}
+
+func (s *Stats) recordTransition(workflow string, transition model.Transition) {
+	transitions, ok := s.transitions[workflow]
+	if !ok {
+		transitions = map[string]int{}
+		s.transitions[workflow] = transitions
+	}
+
+	transitions[transition.String()]++
+}
+
+// CheckStats summarises the runs of a check.
+type CheckStats struct {
+	Runs       int
+	Errors     int
+	Violations int
+
+	// Fail is set if violations of the check fail the run.
+	Fail bool
+
+	// Samples holds the first violations of the check, up to
+	// maxCheckViolations.
+	Samples []model.CheckResult
+}
+
+// Passed returns true if the check's invariant held on every run. A
+// check that failed every time it ran didn't verify its invariant, so
+// doesn't pass; one that failed to run only occasionally (e.g. timing
+// out under load) can still pass.
+func (c *CheckStats) Passed() bool {
+	return c.Violations == 0 && c.Errors < c.Runs
+}
+
+func (s *Stats) recordCheck(result model.CheckResult, err error) {
+	check, ok := s.checks[result.Name]
+	if !ok {
+		check = &CheckStats{}
+		s.checks[result.Name] = check
+	}
+
+	check.Runs++
+	check.Fail = result.Fail
+
+	switch {
+	case err != nil:
+		check.Errors++
+	case result.Violation != "":
+		check.Violations++
+		if len(check.Samples) < maxCheckViolations {
+			check.Samples = append(check.Samples, result)
+		}
+	}
+}
+
+// recordErrorMessage counts the occurrences of each distinct error
+// message for a key, grouping messages beyond the first few into a
+// single entry to bound memory use.
+func (s *Stats) recordErrorMessage(key, msg string) {
+	messages, ok := s.errorMessages[key]
+	if !ok {
+		messages = map[string]int{}
+		s.errorMessages[key] = messages
+	}
+
+	if _, ok := messages[msg]; !ok && len(messages) >= maxErrorMessages {
+		msg = otherErrorMessages
+	}
+
+	messages[msg]++
+}
+
+func (s *Stats) recordErrorClass(key string, class repo.ErrorClass) {
+	classes, ok := s.errorClasses[key]
+	if !ok {
+		classes = map[repo.ErrorClass]int{}
+		s.errorClasses[key] = classes
+	}
+
+	classes[class]++
+}
+
+// Interval returns a snapshot containing the response times recorded
+// since the previous interval, before rolling them into the run's
+// cumulative response times.
+func (s *Stats) Interval() Snapshot {
+	now := time.Now()
+
+	snapshot := Snapshot{
+		Counts:            s.counts,
+		Errors:            s.errors,
+		ErrorMessages:     s.errorMessages,
+		ErrorClasses:      s.errorClasses,
+		Expected:          s.expected,
+		AssertionFailures: s.assertions,
+		Retried:           s.retried,
+		Retries:           s.retries,
+		Latencies:         s.latencies,
+		Transitions:       s.transitions,
+		Checks:            s.checks,
+		Histograms:        s.interval,
+		Elapsed:           now.Sub(s.intervalStart),
+	}
+
+	for key, h := range s.interval {
+		if _, ok := s.cumulative[key]; !ok {
+			s.cumulative[key] = NewHistogram()
+		}
+		s.cumulative[key].Merge(h)
+	}
+
+	s.interval = map[string]*Histogram{}
+	s.intervalStart = now
+
+	return snapshot
+}
+
+// Cumulative returns a snapshot containing all of the response times
+// recorded since the start of the run.
+func (s *Stats) Cumulative() Snapshot {
+	histograms := map[string]*Histogram{}
+
+	for key, h := range s.cumulative {
+		histograms[key] = NewHistogram()
+		histograms[key].Merge(h)
+	}
+
+	for key, h := range s.interval {
+		if _, ok := histograms[key]; !ok {
+			histograms[key] = NewHistogram()
+		}
+		histograms[key].Merge(h)
+	}
+
+	return Snapshot{
+		Counts:            s.counts,
+		Errors:            s.errors,
+		ErrorMessages:     s.errorMessages,
+		ErrorClasses:      s.errorClasses,
+		Expected:          s.expected,
+		AssertionFailures: s.assertions,
+		Retried:           s.retried,
+		Retries:           s.retries,
+		Latencies:         s.latencies,
+		Transitions:       s.transitions,
+		Checks:            s.checks,
+		Histograms:        histograms,
+		Elapsed:           time.Since(s.start),
+	}
+}
+
+// keys returns the sorted keys of every workflow query with a
+// recorded outcome.
+func (s Snapshot) keys() []string {
+	keys := lo.Uniq(slices.Concat(lo.Keys(s.Counts), lo.Keys(s.Errors), lo.Keys(s.Expected), lo.Keys(s.AssertionFailures)))
+	sort.Strings(keys)
+
+	return keys
+}
+
+// total returns the number of requests made for a key, whatever their
+// outcome.
+func (s Snapshot) total(key string) int {
+	return s.Counts[key] + s.Errors[key] + s.Expected[key] + s.AssertionFailures[key]
+}
+
+// averageLatency returns the mean of a key's most recent successful
+// response times, or zero if it has none.
+func (s Snapshot) averageLatency(key string) time.Duration {
+	r, ok := s.Latencies[key]
+	if !ok {
+		return 0
+	}
+
+	latencies := r.Slice()
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	return lo.Sum(latencies) / time.Duration(len(latencies))
+}
+
+// ChecksPassed returns true if no check that fails the run was
+// violated.
+func ChecksPassed(snapshot Snapshot) bool {
+	return lo.EveryBy(lo.Values(snapshot.Checks), func(c *CheckStats) bool {
+		return !c.Fail || c.Passed()
+	})
+}
+
+// Throughput returns the number of successful requests per second for
+// a key.
+func (s Snapshot) Throughput(key string) float64 {
+	h, ok := s.Histograms[key]
+	if !ok || s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(h.Count()) / s.Elapsed.Seconds()
+}
+
+// ParsePercentiles parses a comma-separated list of percentiles (e.g.
+// "50,95,99.9").
+func ParsePercentiles(s string) ([]float64, error) {
+	var percentiles []float64
+
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		p, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing percentile %q: %w", part, err)
+		}
+
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("percentile %q out of range (0 < p <= 100)", part)
+		}
+
+		percentiles = append(percentiles, p)
+	}
+
+	return percentiles, nil
+}
+
+// Events from setup and teardown queries are published with their
+// workflow names prefixed, so they can be reported separately.
+const (
+	setupPrefix    = "*"
+	teardownPrefix = "~"
+)
+
+func isSetupKey(key string) bool {
+	return strings.HasPrefix(key, setupPrefix)
+}
+
+func isTeardownKey(key string) bool {
+	return strings.HasPrefix(key, teardownPrefix)
+}
+
+func isWorkloadKey(key string) bool {
+	return !isSetupKey(key) && !isTeardownKey(key)
+}
+
+func trimKeyPrefix(key string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(key, setupPrefix), teardownPrefix)
+}
+
+func percentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
@@ -0,0 +1,64 @@
+package monitoring
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksPassed(t *testing.T) {
+	cases := []struct {
+		name      string
+		results   []model.CheckResult
+		errs      []error
+		expPassed bool
+	}{
+		{
+			name:      "no checks",
+			expPassed: true,
+		},
+		{
+			name:      "held",
+			results:   []model.CheckResult{{Name: "a", Fail: true}, {Name: "a", Fail: true}},
+			errs:      []error{nil, nil},
+			expPassed: true,
+		},
+		{
+			name:      "violated",
+			results:   []model.CheckResult{{Name: "a", Fail: true}, {Name: "a", Violation: "oops", Fail: true}},
+			errs:      []error{nil, nil},
+			expPassed: false,
+		},
+		{
+			name:      "violated with warn",
+			results:   []model.CheckResult{{Name: "a", Violation: "oops"}},
+			errs:      []error{nil},
+			expPassed: true,
+		},
+		{
+			name:      "occasional errors",
+			results:   []model.CheckResult{{Name: "a", Fail: true}, {Name: "a", Fail: true}},
+			errs:      []error{errors.New("timeout"), nil},
+			expPassed: true,
+		},
+		{
+			name:      "never ran successfully",
+			results:   []model.CheckResult{{Name: "a", Fail: true}, {Name: "a", Fail: true}},
+			errs:      []error{errors.New("connection refused"), errors.New("connection refused")},
+			expPassed: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stats := NewStats(10)
+			for i, result := range c.results {
+				stats.Record(model.Event{Check: &result, Err: c.errs[i]})
+			}
+
+			assert.Equal(t, c.expPassed, ChecksPassed(stats.Cumulative()))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package monitoring
+
+import (
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/samber/lo"
+)
+
+// ThresholdResult is the outcome of evaluating a threshold against each
+// of the workflow queries it selects.
+type ThresholdResult struct {
+	Threshold model.Threshold
+	Values    []ThresholdValue
+	Passed    bool
+}
+
+// ThresholdValue is the value of a threshold's metric for a single
+// workflow query.
+type ThresholdValue struct {
+	Key    string
+	Actual float64
+	Passed bool
+}
+
+// EvaluateThresholds evaluates thresholds against a snapshot of a run's
+// statistics. Setup and teardown queries are not evaluated, and a
+// threshold that doesn't select any workflow queries fails, as does a
+// latency threshold for a query without any successful requests.
+func EvaluateThresholds(thresholds []model.Threshold, snapshot Snapshot) []ThresholdResult {
+	keys := snapshot.keys()
+
+	keys = lo.Filter(keys, func(key string, _ int) bool {
+		return isWorkloadKey(key)
+	})
+
+	results := make([]ThresholdResult, 0, len(thresholds))
+
+	for _, t := range thresholds {
+		result := ThresholdResult{
+			Threshold: t,
+			Passed:    true,
+		}
+
+		for _, key := range keys {
+			if !t.Matches(key) {
+				continue
+			}
+
+			actual, ok := thresholdActual(t, snapshot, key)
+			passed := ok && t.Check(actual)
+
+			result.Values = append(result.Values, ThresholdValue{
+				Key:    key,
+				Actual: actual,
+				Passed: passed,
+			})
+
+			result.Passed = result.Passed && passed
+		}
+
+		if len(result.Values) == 0 {
+			result.Passed = false
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// ThresholdsPassed returns true if every threshold passed.
+func ThresholdsPassed(results []ThresholdResult) bool {
+	return lo.EveryBy(results, func(r ThresholdResult) bool {
+		return r.Passed
+	})
+}
+
+// ThresholdBreached returns the first abortable threshold that has been
+// breached by a workflow query, if any.
+func ThresholdBreached(results []ThresholdResult, snapshot Snapshot) (ThresholdResult, bool) {
+	return lo.Find(results, func(r ThresholdResult) bool {
+		return r.Threshold.Abort &&
+			snapshot.Elapsed >= r.Threshold.AbortAfter &&
+			len(r.Values) > 0 &&
+			!r.Passed
+	})
+}
+
+// thresholdActual returns the value of a threshold's metric for a
+// workflow query, and false if the query has no value for it.
+func thresholdActual(t model.Threshold, snapshot Snapshot, key string) (float64, bool) {
+	switch t.Metric {
+	case model.ThresholdMetricRequests:
+		return float64(snapshot.Counts[key]), true
+
+	case model.ThresholdMetricErrors:
+		return float64(snapshot.Errors[key]), true
+
+	case model.ThresholdMetricAssertionFailures:
+		return float64(snapshot.AssertionFailures[key]), true
+
+	case model.ThresholdMetricErrorRate:
+		total := snapshot.total(key)
+		if total == 0 {
+			return 0, true
+		}
+		return float64(snapshot.Errors[key]) / float64(total), true
+
+	case model.ThresholdMetricRPS:
+		return snapshot.Throughput(key), true
+
+	case model.ThresholdMetricMin, model.ThresholdMetricAvg, model.ThresholdMetricMax, model.ThresholdMetricPercentile:
+		return thresholdLatency(t, snapshot.Histograms[key])
+
+	default:
+		return 0, false
+	}
+}
+
+// thresholdLatency returns the value of a latency metric from the
+// response times of a workflow query's successful requests, and false
+// if there weren't any.
+func thresholdLatency(t model.Threshold, histogram *Histogram) (float64, bool) {
+	if histogram == nil || histogram.Count() == 0 {
+		return 0, false
+	}
+
+	switch t.Metric {
+	case model.ThresholdMetricMin:
+		return float64(histogram.Min()), true
+	case model.ThresholdMetricAvg:
+		return float64(histogram.Mean()), true
+	case model.ThresholdMetricMax:
+		return float64(histogram.Max()), true
+	default:
+		return float64(histogram.Percentile(t.Percentile)), true
+	}
+}
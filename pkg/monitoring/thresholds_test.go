@@ -0,0 +1,248 @@
+package monitoring
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/codingconcepts/drk/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func thresholdSnapshot() Snapshot {
+	checkout := NewHistogram()
+	for i := range 100 {
+		checkout.Record(time.Duration(i+1) * time.Millisecond)
+	}
+
+	browse := NewHistogram()
+	for range 200 {
+		browse.Record(time.Millisecond * 5)
+	}
+
+	setup := NewHistogram()
+	setup.Record(time.Second * 10)
+
+	return Snapshot{
+		Counts: map[string]int{
+			"shop.checkout":  100,
+			"shop.browse":    200,
+			"admin.checkout": 0,
+			"*shop.seed":     1,
+		},
+		Errors: map[string]int{
+			"shop.checkout": 25,
+			"*shop.seed":    1,
+		},
+		Expected: map[string]int{
+			"shop.checkout": 25,
+		},
+		AssertionFailures: map[string]int{
+			"shop.browse": 2,
+		},
+		Histograms: map[string]*Histogram{
+			"shop.checkout": checkout,
+			"shop.browse":   browse,
+			"*shop.seed":    setup,
+		},
+		Elapsed: time.Second * 10,
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+		expPassed  bool
+		expValues  []ThresholdValue
+	}{
+		{
+			name:       "query selector matches every workflow",
+			expression: "checkout.requests >= 100",
+			expPassed:  false,
+			expValues: []ThresholdValue{
+				{Key: "admin.checkout", Actual: 0, Passed: false},
+				{Key: "shop.checkout", Actual: 100, Passed: true},
+			},
+		},
+		{
+			name:       "workflow selector",
+			expression: "shop.checkout.requests >= 100",
+			expPassed:  true,
+			expValues: []ThresholdValue{
+				{Key: "shop.checkout", Actual: 100, Passed: true},
+			},
+		},
+		{
+			name:       "workflow glob skips setup queries",
+			expression: "shop.*.errors < 30",
+			expPassed:  true,
+			expValues: []ThresholdValue{
+				{Key: "shop.browse", Actual: 0, Passed: true},
+				{Key: "shop.checkout", Actual: 25, Passed: true},
+			},
+		},
+		{
+			name:       "error rate counts expected errors in the total",
+			expression: "shop.checkout.error_rate < 15%",
+			expPassed:  false,
+			expValues: []ThresholdValue{
+				{Key: "shop.checkout", Actual: 25.0 / 150.0, Passed: false},
+			},
+		},
+		{
+			name:       "error rate with no requests",
+			expression: "admin.*.error_rate == 0",
+			expPassed:  true,
+			expValues: []ThresholdValue{
+				{Key: "admin.checkout", Actual: 0, Passed: true},
+			},
+		},
+		{
+			name:       "assertion failures",
+			expression: "*.assertion_failures == 0",
+			expPassed:  false,
+			expValues: []ThresholdValue{
+				{Key: "admin.checkout", Actual: 0, Passed: true},
+				{Key: "shop.browse", Actual: 2, Passed: false},
+				{Key: "shop.checkout", Actual: 0, Passed: true},
+			},
+		},
+		{
+			name:       "rps",
+			expression: "shop.*.rps >= 10",
+			expPassed:  true,
+			expValues: []ThresholdValue{
+				{Key: "shop.browse", Actual: 20, Passed: true},
+				{Key: "shop.checkout", Actual: 10, Passed: true},
+			},
+		},
+		{
+			name:       "percentile",
+			expression: "shop.checkout.p99 < 100ms",
+			expPassed:  true,
+			expValues: []ThresholdValue{
+				// The highest value in the bucket that 99ms is recorded in.
+				{Key: "shop.checkout", Actual: float64(time.Millisecond*99 + time.Microsecond*7), Passed: true},
+			},
+		},
+		{
+			name:       "max",
+			expression: "shop.checkout.max < 100ms",
+			expPassed:  false,
+			expValues: []ThresholdValue{
+				{Key: "shop.checkout", Actual: float64(time.Millisecond * 100), Passed: false},
+			},
+		},
+		{
+			name:       "no matching queries",
+			expression: "payments.p99 < 1s",
+			expPassed:  false,
+		},
+	}
+
+	snapshot := thresholdSnapshot()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			threshold, err := model.ParseThreshold(c.expression)
+			assert.NoError(t, err)
+
+			results := EvaluateThresholds([]model.Threshold{threshold}, snapshot)
+			assert.Len(t, results, 1)
+			assert.Equal(t, c.expPassed, results[0].Passed)
+			assert.Equal(t, c.expValues, results[0].Values)
+			assert.Equal(t, c.expPassed, ThresholdsPassed(results))
+		})
+	}
+}
+
+func TestThresholdBreached(t *testing.T) {
+	parse := func(expression string, abort bool, abortAfter time.Duration) model.Threshold {
+		threshold, err := model.ParseThreshold(expression)
+		assert.NoError(t, err)
+
+		threshold.Abort = abort
+		threshold.AbortAfter = abortAfter
+		return threshold
+	}
+
+	cases := []struct {
+		name       string
+		thresholds []model.Threshold
+		expBreach  string
+	}{
+		{
+			name:       "abortable threshold breached",
+			thresholds: []model.Threshold{parse("shop.*.errors == 0", true, 0)},
+			expBreach:  "shop.*.errors == 0",
+		},
+		{
+			name:       "first breached abortable threshold",
+			thresholds: []model.Threshold{parse("shop.*.errors == 0", false, 0), parse("shop.checkout.p99 < 10ms", true, 0), parse("shop.*.max < 1ms", true, 0)},
+			expBreach:  "shop.checkout.p99 < 10ms",
+		},
+		{
+			name:       "not abortable",
+			thresholds: []model.Threshold{parse("shop.*.errors == 0", false, 0)},
+		},
+		{
+			name:       "abortable threshold passing",
+			thresholds: []model.Threshold{parse("shop.*.errors < 100", true, 0)},
+		},
+		{
+			name:       "before abort_after",
+			thresholds: []model.Threshold{parse("shop.*.errors == 0", true, time.Minute)},
+		},
+		{
+			name:       "no matching queries",
+			thresholds: []model.Threshold{parse("payments.errors == 0", true, 0)},
+		},
+	}
+
+	snapshot := thresholdSnapshot()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			breached, ok := ThresholdBreached(EvaluateThresholds(c.thresholds, snapshot), snapshot)
+			assert.Equal(t, c.expBreach != "", ok)
+			if ok {
+				assert.Equal(t, c.expBreach, breached.Threshold.String())
+			}
+		})
+	}
+}
+
+func TestEvaluateThresholdsEveryRequestFailed(t *testing.T) {
+	stats := NewStats(100)
+	for range 100 {
+		stats.Record(model.Event{Workflow: "shop", Name: "checkout", ResponseTime: time.Millisecond, Err: errors.New("connection refused")})
+	}
+	snapshot := stats.Cumulative()
+
+	// Failed requests don't count towards latency or throughput, so a run
+	// in which every request failed quickly doesn't pass either.
+	cases := []struct {
+		expression string
+		expActual  float64
+	}{
+		{expression: "checkout.p99 < 250ms"},
+		{expression: "checkout.min < 250ms"},
+		{expression: "checkout.avg < 250ms"},
+		{expression: "checkout.max < 250ms"},
+		{expression: "checkout.rps > 50"},
+		{expression: "checkout.requests > 0"},
+		{expression: "checkout.error_rate < 1%", expActual: 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expression, func(t *testing.T) {
+			threshold, err := model.ParseThreshold(c.expression)
+			assert.NoError(t, err)
+
+			results := EvaluateThresholds([]model.Threshold{threshold}, snapshot)
+			assert.False(t, ThresholdsPassed(results))
+			assert.Equal(t, []ThresholdValue{{Key: "shop.checkout", Actual: c.expActual, Passed: false}}, results[0].Values)
+		})
+	}
+}
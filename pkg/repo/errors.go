@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/samber/lo"
+	"github.com/sijms/go-ora/v2/network"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// retryableSQLStates are the SQLSTATE codes of errors that are
+	// resolved by retrying the transaction that encountered them.
+	retryableSQLStates = map[string]struct{}{
+		"40001": {}, // serialization_failure
+		"40P01": {}, // deadlock_detected
+	}
+)
+
+// IsRetryable returns true if the error was caused by a serialization
+// failure or deadlock, meaning the transaction should be retried.
+func IsRetryable(err error) bool {
+	state, ok := sqlState(err)
+	if !ok {
+		return false
+	}
+
+	_, ok = retryableSQLStates[state]
+	return ok
+}
+
+func sqlState(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return string(mysqlErr.SQLState[:]), true
+	}
+
+	return "", false
+}
+
+// ErrorCategory is the broad cause of a failed request.
+type ErrorCategory string
+
+const (
+	ErrorCategoryTimeout    ErrorCategory = "timeout"
+	ErrorCategoryConnection ErrorCategory = "connection"
+	ErrorCategoryRetryable  ErrorCategory = "retryable"
+	ErrorCategoryConstraint ErrorCategory = "constraint"
+	ErrorCategorySyntax     ErrorCategory = "syntax"
+	ErrorCategoryOther      ErrorCategory = "other"
+)
+
+// ErrorClass identifies an error by its driver-native code (a SQLSTATE
+// for pgx, an error number for mysql, an ORA code for oracle, and a
+// gRPC code for spanner) and its category. Code is empty for errors
+// that didn't come from the database.
+type ErrorClass struct {
+	Category ErrorCategory
+	Code     string
+}
+
+func (c ErrorClass) String() string {
+	if c.Code == "" {
+		return string(c.Category)
+	}
+
+	return fmt.Sprintf("%s (%s)", c.Category, c.Code)
+}
+
+var (
+	// mysqlErrorCategories are the categories of MySQL error numbers.
+	mysqlErrorCategories = map[uint16]ErrorCategory{
+		1205: ErrorCategoryTimeout,    // ER_LOCK_WAIT_TIMEOUT
+		3024: ErrorCategoryTimeout,    // ER_QUERY_TIMEOUT
+		1213: ErrorCategoryRetryable,  // ER_LOCK_DEADLOCK
+		1048: ErrorCategoryConstraint, // ER_BAD_NULL_ERROR
+		1062: ErrorCategoryConstraint, // ER_DUP_ENTRY
+		1451: ErrorCategoryConstraint, // ER_ROW_IS_REFERENCED_2
+		1452: ErrorCategoryConstraint, // ER_NO_REFERENCED_ROW_2
+		3819: ErrorCategoryConstraint, // ER_CHECK_CONSTRAINT_VIOLATED
+		1054: ErrorCategorySyntax,     // ER_BAD_FIELD_ERROR
+		1064: ErrorCategorySyntax,     // ER_PARSE_ERROR
+		1146: ErrorCategorySyntax,     // ER_NO_SUCH_TABLE
+		1040: ErrorCategoryConnection, // ER_CON_COUNT_ERROR
+		1053: ErrorCategoryConnection, // ER_SERVER_SHUTDOWN
+	}
+
+	// oracleErrorCategories are the categories of ORA error codes.
+	oracleErrorCategories = map[int]ErrorCategory{
+		51:    ErrorCategoryTimeout,    // timeout waiting for resource
+		1013:  ErrorCategoryTimeout,    // user requested cancel of current operation
+		60:    ErrorCategoryRetryable,  // deadlock detected
+		8177:  ErrorCategoryRetryable,  // can't serialize access
+		1:     ErrorCategoryConstraint, // unique constraint violated
+		1400:  ErrorCategoryConstraint, // cannot insert NULL
+		2290:  ErrorCategoryConstraint, // check constraint violated
+		2291:  ErrorCategoryConstraint, // parent key not found
+		2292:  ErrorCategoryConstraint, // child record found
+		3113:  ErrorCategoryConnection, // end-of-file on communication channel
+		3114:  ErrorCategoryConnection, // not connected to ORACLE
+		3135:  ErrorCategoryConnection, // connection lost contact
+		12170: ErrorCategoryConnection, // connect timeout occurred
+		12514: ErrorCategoryConnection, // listener does not know of service
+		12541: ErrorCategoryConnection, // no listener
+	}
+
+	// grpcErrorCategories are the categories of the gRPC codes returned
+	// by spanner.
+	grpcErrorCategories = map[codes.Code]ErrorCategory{
+		codes.DeadlineExceeded:   ErrorCategoryTimeout,
+		codes.Aborted:            ErrorCategoryRetryable,
+		codes.AlreadyExists:      ErrorCategoryConstraint,
+		codes.FailedPrecondition: ErrorCategoryConstraint,
+		codes.InvalidArgument:    ErrorCategorySyntax,
+		codes.Unavailable:        ErrorCategoryConnection,
+	}
+)
+
+// Classify returns the class of an error returned by a query, based on
+// the error code of the driver that returned it.
+func Classify(err error) ErrorClass {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return ErrorClass{Category: pgErrorCategory(pgErr.Code), Code: pgErr.Code}
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return ErrorClass{
+			Category: lo.ValueOr(mysqlErrorCategories, mysqlErr.Number, ErrorCategoryOther),
+			Code:     strconv.Itoa(int(mysqlErr.Number)),
+		}
+	}
+
+	var oraErr *network.OracleError
+	if errors.As(err, &oraErr) {
+		category, ok := oracleErrorCategories[oraErr.ErrCode]
+		if !ok && oraErr.ErrCode >= 900 && oraErr.ErrCode < 1000 {
+			category, ok = ErrorCategorySyntax, true
+		}
+
+		return ErrorClass{
+			Category: lo.Ternary(ok, category, ErrorCategoryOther),
+			Code:     fmt.Sprintf("ORA-%05d", oraErr.ErrCode),
+		}
+	}
+
+	if s, ok := status.FromError(err); ok && s.Code() != codes.OK && s.Code() != codes.Unknown {
+		return ErrorClass{
+			Category: lo.ValueOr(grpcErrorCategories, s.Code(), ErrorCategoryOther),
+			Code:     s.Code().String(),
+		}
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClass{Category: ErrorCategoryTimeout}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn), errors.As(err, &netErr):
+		return ErrorClass{Category: ErrorCategoryConnection}
+	default:
+		return ErrorClass{Category: ErrorCategoryOther}
+	}
+}
+
+// pgErrorCategory returns the category of a SQLSTATE code.
+func pgErrorCategory(state string) ErrorCategory {
+	if _, ok := retryableSQLStates[state]; ok {
+		return ErrorCategoryRetryable
+	}
+
+	switch state {
+	case "57014", // query_canceled (e.g. by statement_timeout)
+		"55P03": // lock_not_available
+		return ErrorCategoryTimeout
+	case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		return ErrorCategoryConnection
+	}
+
+	if len(state) < 2 {
+		return ErrorCategoryOther
+	}
+
+	switch state[:2] {
+	case "08": // connection_exception
+		return ErrorCategoryConnection
+	case "23": // integrity_constraint_violation
+		return ErrorCategoryConstraint
+	case "42": // syntax_error_or_access_rule_violation
+		return ErrorCategorySyntax
+	default:
+		return ErrorCategoryOther
+	}
+}
@@ -0,0 +1,257 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sijms/go-ora/v2/network"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		exp  bool
+	}{
+		{name: "nil", err: nil, exp: false},
+		{name: "plain error", err: errors.New("something went wrong"), exp: false},
+		{name: "pgx serialization failure", err: &pgconn.PgError{Code: "40001"}, exp: true},
+		{name: "pgx deadlock", err: &pgconn.PgError{Code: "40P01"}, exp: true},
+		{name: "pgx unique violation", err: &pgconn.PgError{Code: "23505"}, exp: false},
+		{name: "mysql deadlock", err: &mysql.MySQLError{Number: 1213, SQLState: [5]byte{'4', '0', '0', '0', '1'}}, exp: true},
+		{name: "mysql duplicate entry", err: &mysql.MySQLError{Number: 1062, SQLState: [5]byte{'2', '3', '0', '0', '0'}}, exp: false},
+		{name: "wrapped", err: fmt.Errorf("running transaction: %w", fmt.Errorf("running query: %w", &pgconn.PgError{Code: "40001"})), exp: true},
+		{name: "joined with rollback error", err: errors.Join(&pgconn.PgError{Code: "40P01"}, errors.New("rolling back")), exp: true},
+		{name: "joined without retryable error", err: errors.Join(&pgconn.PgError{Code: "23505"}, errors.New("rolling back")), exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, IsRetryable(c.err))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		exp  ErrorClass
+	}{
+		{
+			name: "pgx serialization failure",
+			err:  &pgconn.PgError{Code: "40001"},
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "40001"},
+		},
+		{
+			name: "pgx deadlock",
+			err:  &pgconn.PgError{Code: "40P01"},
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "40P01"},
+		},
+		{
+			name: "pgx query cancelled",
+			err:  &pgconn.PgError{Code: "57014"},
+			exp:  ErrorClass{Category: ErrorCategoryTimeout, Code: "57014"},
+		},
+		{
+			name: "pgx lock not available",
+			err:  &pgconn.PgError{Code: "55P03"},
+			exp:  ErrorClass{Category: ErrorCategoryTimeout, Code: "55P03"},
+		},
+		{
+			name: "pgx admin shutdown",
+			err:  &pgconn.PgError{Code: "57P01"},
+			exp:  ErrorClass{Category: ErrorCategoryConnection, Code: "57P01"},
+		},
+		{
+			name: "pgx connection exception class",
+			err:  &pgconn.PgError{Code: "08006"},
+			exp:  ErrorClass{Category: ErrorCategoryConnection, Code: "08006"},
+		},
+		{
+			name: "pgx unique violation",
+			err:  &pgconn.PgError{Code: "23505"},
+			exp:  ErrorClass{Category: ErrorCategoryConstraint, Code: "23505"},
+		},
+		{
+			name: "pgx undefined table",
+			err:  &pgconn.PgError{Code: "42P01"},
+			exp:  ErrorClass{Category: ErrorCategorySyntax, Code: "42P01"},
+		},
+		{
+			name: "pgx other",
+			err:  &pgconn.PgError{Code: "22012"},
+			exp:  ErrorClass{Category: ErrorCategoryOther, Code: "22012"},
+		},
+		{
+			name: "pgx short code",
+			err:  &pgconn.PgError{Code: "X"},
+			exp:  ErrorClass{Category: ErrorCategoryOther, Code: "X"},
+		},
+		{
+			name: "pgx wrapped",
+			err:  fmt.Errorf("running query: %w", &pgconn.PgError{Code: "40001"}),
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "40001"},
+		},
+		{
+			name: "mysql lock wait timeout",
+			err:  &mysql.MySQLError{Number: 1205},
+			exp:  ErrorClass{Category: ErrorCategoryTimeout, Code: "1205"},
+		},
+		{
+			name: "mysql deadlock",
+			err:  &mysql.MySQLError{Number: 1213, SQLState: [5]byte{'4', '0', '0', '0', '1'}},
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "1213"},
+		},
+		{
+			name: "mysql duplicate entry",
+			err:  &mysql.MySQLError{Number: 1062},
+			exp:  ErrorClass{Category: ErrorCategoryConstraint, Code: "1062"},
+		},
+		{
+			name: "mysql parse error",
+			err:  &mysql.MySQLError{Number: 1064},
+			exp:  ErrorClass{Category: ErrorCategorySyntax, Code: "1064"},
+		},
+		{
+			name: "mysql too many connections",
+			err:  &mysql.MySQLError{Number: 1040},
+			exp:  ErrorClass{Category: ErrorCategoryConnection, Code: "1040"},
+		},
+		{
+			name: "mysql other",
+			err:  &mysql.MySQLError{Number: 1044},
+			exp:  ErrorClass{Category: ErrorCategoryOther, Code: "1044"},
+		},
+		{
+			name: "mysql wrapped",
+			err:  fmt.Errorf("running query: %w", &mysql.MySQLError{Number: 1062}),
+			exp:  ErrorClass{Category: ErrorCategoryConstraint, Code: "1062"},
+		},
+		{
+			name: "oracle unique constraint",
+			err:  &network.OracleError{ErrCode: 1},
+			exp:  ErrorClass{Category: ErrorCategoryConstraint, Code: "ORA-00001"},
+		},
+		{
+			name: "oracle serialization failure",
+			err:  &network.OracleError{ErrCode: 8177},
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "ORA-08177"},
+		},
+		{
+			name: "oracle no listener",
+			err:  &network.OracleError{ErrCode: 12541},
+			exp:  ErrorClass{Category: ErrorCategoryConnection, Code: "ORA-12541"},
+		},
+		{
+			name: "oracle start of syntax range",
+			err:  &network.OracleError{ErrCode: 900},
+			exp:  ErrorClass{Category: ErrorCategorySyntax, Code: "ORA-00900"},
+		},
+		{
+			name: "oracle end of syntax range",
+			err:  &network.OracleError{ErrCode: 999},
+			exp:  ErrorClass{Category: ErrorCategorySyntax, Code: "ORA-00999"},
+		},
+		{
+			name: "oracle after syntax range",
+			err:  &network.OracleError{ErrCode: 1000},
+			exp:  ErrorClass{Category: ErrorCategoryOther, Code: "ORA-01000"},
+		},
+		{
+			name: "oracle before syntax range",
+			err:  &network.OracleError{ErrCode: 899},
+			exp:  ErrorClass{Category: ErrorCategoryOther, Code: "ORA-00899"},
+		},
+		{
+			name: "oracle wrapped",
+			err:  fmt.Errorf("running query: %w", &network.OracleError{ErrCode: 60}),
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "ORA-00060"},
+		},
+		{
+			name: "spanner aborted",
+			err:  status.Error(codes.Aborted, "transaction aborted"),
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "Aborted"},
+		},
+		{
+			name: "spanner deadline exceeded",
+			err:  status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			exp:  ErrorClass{Category: ErrorCategoryTimeout, Code: "DeadlineExceeded"},
+		},
+		{
+			name: "spanner already exists",
+			err:  status.Error(codes.AlreadyExists, "row already exists"),
+			exp:  ErrorClass{Category: ErrorCategoryConstraint, Code: "AlreadyExists"},
+		},
+		{
+			name: "spanner invalid argument",
+			err:  status.Error(codes.InvalidArgument, "syntax error"),
+			exp:  ErrorClass{Category: ErrorCategorySyntax, Code: "InvalidArgument"},
+		},
+		{
+			name: "spanner unavailable",
+			err:  status.Error(codes.Unavailable, "unavailable"),
+			exp:  ErrorClass{Category: ErrorCategoryConnection, Code: "Unavailable"},
+		},
+		{
+			name: "spanner other",
+			err:  status.Error(codes.PermissionDenied, "permission denied"),
+			exp:  ErrorClass{Category: ErrorCategoryOther, Code: "PermissionDenied"},
+		},
+		{
+			name: "spanner wrapped",
+			err:  fmt.Errorf("running query: %w", status.Error(codes.Aborted, "transaction aborted")),
+			exp:  ErrorClass{Category: ErrorCategoryRetryable, Code: "Aborted"},
+		},
+		{
+			name: "grpc unknown falls through",
+			err:  status.Error(codes.Unknown, "unknown"),
+			exp:  ErrorClass{Category: ErrorCategoryOther},
+		},
+		{
+			name: "context deadline exceeded",
+			err:  fmt.Errorf("running query: %w", context.DeadlineExceeded),
+			exp:  ErrorClass{Category: ErrorCategoryTimeout},
+		},
+		{
+			name: "bad connection",
+			err:  fmt.Errorf("running query: %w", driver.ErrBadConn),
+			exp:  ErrorClass{Category: ErrorCategoryConnection},
+		},
+		{
+			name: "mysql invalid connection",
+			err:  fmt.Errorf("running query: %w", mysql.ErrInvalidConn),
+			exp:  ErrorClass{Category: ErrorCategoryConnection},
+		},
+		{
+			name: "network error",
+			err:  fmt.Errorf("running query: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}),
+			exp:  ErrorClass{Category: ErrorCategoryConnection},
+		},
+		{
+			name: "other",
+			err:  errors.New("something went wrong"),
+			exp:  ErrorClass{Category: ErrorCategoryOther},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, Classify(c.err))
+		})
+	}
+}
+
+func TestErrorClassString(t *testing.T) {
+	assert.Equal(t, "retryable (40001)", ErrorClass{Category: ErrorCategoryRetryable, Code: "40001"}.String())
+	assert.Equal(t, "timeout", ErrorClass{Category: ErrorCategoryTimeout}.String())
+}
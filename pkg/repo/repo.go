@@ -11,46 +11,55 @@ import (
 )
 
 type Queryer interface {
-	Query(query string, args ...any) ([]map[string]any, time.Duration, error)
-	Exec(query string, args ...any) (time.Duration, error)
+	Query(ctx context.Context, query string, args ...any) ([]map[string]any, time.Duration, error)
+	Exec(ctx context.Context, query string, args ...any) (time.Duration, error)
+	Tx(ctx context.Context, opts TxOptions, fn func(Queryer) error) (time.Duration, error)
+
+	// Prepare prepares a statement on the database, so that it can be
+	// run by QueryStmt and ExecStmt (including within transactions)
+	// until it's closed.
+	Prepare(ctx context.Context, query string) (*Stmt, error)
+	QueryStmt(ctx context.Context, stmt *Stmt, args ...any) ([]map[string]any, time.Duration, error)
+	ExecStmt(ctx context.Context, stmt *Stmt, args ...any) (time.Duration, error)
 }
 
+// Stmt is a statement prepared on a database, which can be run by the
+// database and by any of its transactions.
+type Stmt struct {
+	Query string
+
+	stmt *sql.Stmt
+}
+
+// Close releases the statement's resources on the database.
+func (s *Stmt) Close() error {
+	if s.stmt == nil {
+		return nil
+	}
+
+	return s.stmt.Close()
+}
+
+// DBRepo runs queries against a database. Timeouts and retries are
+// left to the caller, as they vary by query.
 type DBRepo struct {
-	db      *sql.DB
-	timeout time.Duration
-	retries int
+	db *sql.DB
 }
 
-func NewDBRepo(db *sql.DB, timeout time.Duration, retries int) *DBRepo {
+func NewDBRepo(db *sql.DB) *DBRepo {
 	return &DBRepo{
-		db:      db,
-		timeout: timeout,
-		retries: retries,
+		db: db,
 	}
 }
 
-func (r *DBRepo) Query(query string, args ...any) (values []map[string]any, taken time.Duration, err error) {
+func (r *DBRepo) Query(ctx context.Context, query string, args ...any) (values []map[string]any, taken time.Duration, err error) {
 	start := time.Now()
 
 	defer func() {
 		taken = time.Since(start)
 	}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-	defer cancel()
-
-	var rows *sql.Rows
-
-	for range r.retries {
-		rows, err = r.db.QueryContext(ctx, query, args...)
-		if err != nil {
-			time.Sleep(time.Millisecond * 10)
-			continue
-		}
-
-		break
-	}
-
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		err = fmt.Errorf("running query: %w", err)
 		return
@@ -69,33 +78,69 @@ func (r *DBRepo) Query(query string, args ...any) (values []map[string]any, take
 	return
 }
 
-func (r *DBRepo) Exec(query string, args ...any) (taken time.Duration, err error) {
+func (r *DBRepo) Exec(ctx context.Context, query string, args ...any) (taken time.Duration, err error) {
 	start := time.Now()
 
 	defer func() {
 		taken = time.Since(start)
 	}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-	defer cancel()
+	if _, err = r.db.ExecContext(ctx, query, args...); err != nil {
+		err = fmt.Errorf("running query: %w", err)
+	}
 
-	for range r.retries {
-		_, err = r.db.ExecContext(ctx, query, args...)
-		if err != nil {
-			time.Sleep(time.Millisecond * 10)
-			continue
-		}
+	return
+}
 
-		break
+func (r *DBRepo) Prepare(ctx context.Context, query string) (*Stmt, error) {
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("preparing statement: %w", err)
 	}
 
-	if err != nil {
+	return &Stmt{Query: query, stmt: stmt}, nil
+}
+
+func (r *DBRepo) QueryStmt(ctx context.Context, stmt *Stmt, args ...any) (values []map[string]any, taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	values, err = scanRows(stmt.stmt.QueryContext(ctx, args...))
+	return
+}
+
+func (r *DBRepo) ExecStmt(ctx context.Context, stmt *Stmt, args ...any) (taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	if _, err = stmt.stmt.ExecContext(ctx, args...); err != nil {
 		err = fmt.Errorf("running query: %w", err)
 	}
 
 	return
 }
 
+// scanRows reads (and closes) the rows returned by a query.
+func scanRows(rows *sql.Rows, err error) ([]map[string]any, error) {
+	if err != nil {
+		return nil, fmt.Errorf("running query: %w", err)
+	}
+	defer rows.Close()
+
+	values, err := readRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return values, nil
+}
+
 func readRows(rows *sql.Rows) ([]map[string]any, error) {
 	columns, err := rows.Columns()
 	if err != nil {
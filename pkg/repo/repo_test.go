@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStmt(t *testing.T) {
+	const query = "SELECT id FROM account"
+	const update = "UPDATE account SET balance = 0"
+
+	fake, db := newFakeDB(map[string][]error{})
+	defer db.Close()
+
+	// A single connection, so that the transaction runs on the connection
+	// the statements were prepared on.
+	db.SetMaxOpenConns(1)
+
+	r := NewDBRepo(db)
+
+	selectStmt, err := r.Prepare(context.Background(), query)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer selectStmt.Close()
+
+	updateStmt, err := r.Prepare(context.Background(), update)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer updateStmt.Close()
+
+	rows, _, err := r.QueryStmt(context.Background(), selectStmt)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"id": int64(1)}}, rows)
+
+	_, err = r.ExecStmt(context.Background(), updateStmt)
+	assert.NoError(t, err)
+
+	_, err = r.Tx(context.Background(), TxOptions{Retry: TxRetryRestart}, func(tx Queryer) error {
+		rows, _, err := tx.QueryStmt(context.Background(), selectStmt)
+		assert.Equal(t, []map[string]any{{"id": int64(1)}}, rows)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecStmt(context.Background(), updateStmt); err != nil {
+			return err
+		}
+
+		_, err = tx.Prepare(context.Background(), query)
+		assert.EqualError(t, err, "preparing statements within transactions is not supported")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Statements are prepared once, and reused within the transaction.
+	assert.Equal(t, []string{
+		"PREPARE " + query,
+		"PREPARE " + update,
+		query,
+		update,
+		"BEGIN",
+		query,
+		update,
+		"COMMIT",
+	}, fake.statements())
+}
+
+func TestPrepareError(t *testing.T) {
+	const query = "SELEC id FROM account"
+
+	_, db := newFakeDB(map[string][]error{"PREPARE " + query: {errors.New("syntax error")}})
+	defer db.Close()
+
+	_, err := NewDBRepo(db).Prepare(context.Background(), query)
+	assert.EqualError(t, err, "preparing statement: syntax error")
+}
@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TxRetryStrategy determines how a transaction is retried after a
+// retryable error.
+type TxRetryStrategy string
+
+const (
+	// TxRetryRestart rolls back the transaction and runs it again in a
+	// new transaction.
+	TxRetryRestart TxRetryStrategy = "restart"
+
+	// TxRetrySavepoint rolls back to a savepoint taken at the start of
+	// the transaction and runs it again within the same transaction,
+	// as per CockroachDB's client-side retry protocol.
+	TxRetrySavepoint TxRetryStrategy = "savepoint"
+
+	restartSavepoint = "cockroach_restart"
+)
+
+// TxOptions configure how a transaction is run.
+type TxOptions struct {
+	Isolation  sql.IsolationLevel
+	Retry      TxRetryStrategy
+	MaxRetries int
+}
+
+// Tx runs the given function in a transaction, committing if it
+// succeeds and retrying it if it fails with a retryable error.
+func (r *DBRepo) Tx(ctx context.Context, opts TxOptions, fn func(Queryer) error) (taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	switch opts.Retry {
+	case TxRetrySavepoint:
+		err = r.savepointTx(ctx, opts, fn)
+
+	default:
+		err = r.restartTx(ctx, opts, fn)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("running transaction: %w", err)
+	}
+
+	return
+}
+
+func (r *DBRepo) restartTx(ctx context.Context, opts TxOptions, fn func(Queryer) error) error {
+	var err error
+
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		if err = r.runTx(ctx, opts, fn); !IsRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (r *DBRepo) runTx(ctx context.Context, opts TxOptions, fn func(Queryer) error) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err = fn(&txRepo{ctx: ctx, tx: tx}); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (r *DBRepo) savepointTx(ctx context.Context, opts TxOptions, fn func(Queryer) error) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "SAVEPOINT "+restartSavepoint); err != nil {
+		return errors.Join(fmt.Errorf("creating savepoint: %w", err), tx.Rollback())
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = fn(&txRepo{ctx: ctx, tx: tx})
+		if err == nil {
+			// Releasing the savepoint is where CockroachDB will report
+			// any serialization failures, so may also need a retry.
+			if _, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+restartSavepoint); err == nil {
+				return tx.Commit()
+			}
+		}
+
+		if !IsRetryable(err) || attempt >= opts.MaxRetries {
+			return errors.Join(err, tx.Rollback())
+		}
+
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+restartSavepoint); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rolling back to savepoint: %w", rbErr), tx.Rollback())
+		}
+	}
+}
+
+// txRepo runs queries within a transaction, using the transaction's
+// context in place of those passed to its methods. Statements prepared
+// on the transaction's database can be run, but not prepared, as that
+// would wait for a second connection while holding this one.
+type txRepo struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (r *txRepo) Query(_ context.Context, query string, args ...any) (values []map[string]any, taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	rows, err := r.tx.QueryContext(r.ctx, query, args...)
+	if err != nil {
+		err = fmt.Errorf("running query: %w", err)
+		return
+	}
+	defer rows.Close()
+
+	values, err = readRows(rows)
+	if err != nil {
+		err = fmt.Errorf("reading rows: %w", err)
+	}
+
+	return
+}
+
+func (r *txRepo) Exec(_ context.Context, query string, args ...any) (taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	if _, err = r.tx.ExecContext(r.ctx, query, args...); err != nil {
+		err = fmt.Errorf("running query: %w", err)
+	}
+
+	return
+}
+
+func (r *txRepo) Prepare(context.Context, string) (*Stmt, error) {
+	return nil, fmt.Errorf("preparing statements within transactions is not supported")
+}
+
+func (r *txRepo) QueryStmt(_ context.Context, stmt *Stmt, args ...any) (values []map[string]any, taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	values, err = scanRows(r.tx.StmtContext(r.ctx, stmt.stmt).QueryContext(r.ctx, args...))
+	return
+}
+
+func (r *txRepo) ExecStmt(_ context.Context, stmt *Stmt, args ...any) (taken time.Duration, err error) {
+	start := time.Now()
+
+	defer func() {
+		taken = time.Since(start)
+	}()
+
+	if _, err = r.tx.StmtContext(r.ctx, stmt.stmt).ExecContext(r.ctx, args...); err != nil {
+		err = fmt.Errorf("running query: %w", err)
+	}
+
+	return
+}
+
+func (r *txRepo) Tx(context.Context, TxOptions, func(Queryer) error) (time.Duration, error) {
+	return 0, fmt.Errorf("nested transactions are not supported")
+}
@@ -0,0 +1,303 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDB is a database whose connections record the statements run on
+// them (along with BEGIN, COMMIT, and ROLLBACK), failing each statement
+// with the errors queued for it, in order.
+type fakeDB struct {
+	mu       sync.Mutex
+	log      []string
+	failures map[string][]error
+}
+
+func newFakeDB(failures map[string][]error) (*fakeDB, *sql.DB) {
+	f := &fakeDB{failures: failures}
+	return f, sql.OpenDB(f)
+}
+
+func (f *fakeDB) run(stmt string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.log = append(f.log, stmt)
+
+	errs := f.failures[stmt]
+	if len(errs) == 0 {
+		return nil
+	}
+
+	f.failures[stmt] = errs[1:]
+	return errs[0]
+}
+
+func (f *fakeDB) statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.log...)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if err := c.db.run("PREPARE " + query); err != nil {
+		return nil, err
+	}
+
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if err := c.db.run("BEGIN"); err != nil {
+		return nil, err
+	}
+
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.run(query); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.run(query); err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if err := s.db.run(s.query); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if err := s.db.run(s.query); err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{}, nil
+}
+
+// fakeRows returns a single row with a single "id" column.
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"ID"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (t *fakeTx) Commit() error {
+	return t.db.run("COMMIT")
+}
+
+func (t *fakeTx) Rollback() error {
+	return t.db.run("ROLLBACK")
+}
+
+func TestTx(t *testing.T) {
+	serializationFailure := &pgconn.PgError{Code: "40001"}
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	uniqueViolation := &pgconn.PgError{Code: "23505"}
+
+	const update = "UPDATE account SET balance = balance - 1"
+
+	cases := []struct {
+		name          string
+		retry         TxRetryStrategy
+		failures      map[string][]error
+		expStatements []string
+		expErr        error
+	}{
+		{
+			name:          "restart committed",
+			retry:         TxRetryRestart,
+			expStatements: []string{"BEGIN", update, "COMMIT"},
+		},
+		{
+			name:     "restart retries statement",
+			retry:    TxRetryRestart,
+			failures: map[string][]error{update: {serializationFailure}},
+			expStatements: []string{
+				"BEGIN", update, "ROLLBACK",
+				"BEGIN", update, "COMMIT",
+			},
+		},
+		{
+			name:     "restart retries commit",
+			retry:    TxRetryRestart,
+			failures: map[string][]error{"COMMIT": {deadlock}},
+			expStatements: []string{
+				"BEGIN", update, "COMMIT",
+				"BEGIN", update, "COMMIT",
+			},
+		},
+		{
+			name:     "restart stops after max retries",
+			retry:    TxRetryRestart,
+			failures: map[string][]error{update: {serializationFailure, serializationFailure, serializationFailure, serializationFailure}},
+			expStatements: []string{
+				"BEGIN", update, "ROLLBACK",
+				"BEGIN", update, "ROLLBACK",
+				"BEGIN", update, "ROLLBACK",
+			},
+			expErr: serializationFailure,
+		},
+		{
+			name:          "restart rolls back non-retryable error",
+			retry:         TxRetryRestart,
+			failures:      map[string][]error{update: {uniqueViolation}},
+			expStatements: []string{"BEGIN", update, "ROLLBACK"},
+			expErr:        uniqueViolation,
+		},
+		{
+			name:          "savepoint committed",
+			retry:         TxRetrySavepoint,
+			expStatements: []string{"BEGIN", "SAVEPOINT cockroach_restart", update, "RELEASE SAVEPOINT cockroach_restart", "COMMIT"},
+		},
+		{
+			name:     "savepoint retries statement",
+			retry:    TxRetrySavepoint,
+			failures: map[string][]error{update: {serializationFailure}},
+			expStatements: []string{
+				"BEGIN", "SAVEPOINT cockroach_restart",
+				update, "ROLLBACK TO SAVEPOINT cockroach_restart",
+				update, "RELEASE SAVEPOINT cockroach_restart", "COMMIT",
+			},
+		},
+		{
+			name:     "savepoint retries release",
+			retry:    TxRetrySavepoint,
+			failures: map[string][]error{"RELEASE SAVEPOINT cockroach_restart": {deadlock}},
+			expStatements: []string{
+				"BEGIN", "SAVEPOINT cockroach_restart",
+				update, "RELEASE SAVEPOINT cockroach_restart", "ROLLBACK TO SAVEPOINT cockroach_restart",
+				update, "RELEASE SAVEPOINT cockroach_restart", "COMMIT",
+			},
+		},
+		{
+			name:     "savepoint stops after max retries",
+			retry:    TxRetrySavepoint,
+			failures: map[string][]error{"RELEASE SAVEPOINT cockroach_restart": {serializationFailure, serializationFailure, serializationFailure}},
+			expStatements: []string{
+				"BEGIN", "SAVEPOINT cockroach_restart",
+				update, "RELEASE SAVEPOINT cockroach_restart", "ROLLBACK TO SAVEPOINT cockroach_restart",
+				update, "RELEASE SAVEPOINT cockroach_restart", "ROLLBACK TO SAVEPOINT cockroach_restart",
+				update, "RELEASE SAVEPOINT cockroach_restart", "ROLLBACK",
+			},
+			expErr: serializationFailure,
+		},
+		{
+			name:     "savepoint rolls back non-retryable error",
+			retry:    TxRetrySavepoint,
+			failures: map[string][]error{update: {uniqueViolation}},
+			expStatements: []string{
+				"BEGIN", "SAVEPOINT cockroach_restart",
+				update, "ROLLBACK",
+			},
+			expErr: uniqueViolation,
+		},
+		{
+			name:     "savepoint rollback to savepoint fails",
+			retry:    TxRetrySavepoint,
+			failures: map[string][]error{update: {serializationFailure}, "ROLLBACK TO SAVEPOINT cockroach_restart": {errors.New("connection lost")}},
+			expStatements: []string{
+				"BEGIN", "SAVEPOINT cockroach_restart",
+				update, "ROLLBACK TO SAVEPOINT cockroach_restart", "ROLLBACK",
+			},
+			expErr: serializationFailure,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake, db := newFakeDB(c.failures)
+			defer db.Close()
+
+			r := NewDBRepo(db)
+
+			_, err := r.Tx(context.Background(), TxOptions{Retry: c.retry, MaxRetries: 2}, func(tx Queryer) error {
+				_, err := tx.Exec(context.Background(), update)
+				return err
+			})
+
+			if c.expErr != nil {
+				assert.ErrorIs(t, err, c.expErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, c.expStatements, fake.statements())
+		})
+	}
+}